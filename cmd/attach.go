@@ -0,0 +1,159 @@
+package cmd
+
+import (
+    "context"
+    "fmt"
+    "github.com/spf13/cobra"
+    "io"
+    "os"
+
+    "k8s.io/client-go/tools/remotecommand"
+)
+
+func newDshAttachCommand(
+    out io.Writer, context *string, namespace *string, nodeName *string,
+    config *dshConfig,
+) *cobra.Command {
+    var container string
+    var stdin bool
+    var tty bool
+    var record string
+
+    dshAttach := &dshCmd{
+        out:    out,
+        config: config,
+    }
+
+    cmd := &cobra.Command{
+        Use:   "attach <daemonset> [<options>]",
+        Short: "attach to a running container in pod for <daemonset>",
+        Long:
+`Attaches to the process already running in a container of the pod of the
+specified daemonset on the specified node, rather than starting a new one
+like exec does. Without -i you only see its output. For example:
+
+kubectl d attach my-daemonset -N my-node -c my-container -it
+
+-i and -t only work if the container was started with stdin and a TTY.`,
+        Annotations: map[string]string{daemonSetArgAnnotation: "true"},
+        Args: cobra.MatchAll(cobra.ExactArgs(1)),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            return dshAttach.attachPod(
+                *context, *namespace, args[0], *nodeName, container, stdin,
+                tty, record,
+            )
+        },
+    }
+
+    cmd.Flags().StringVarP(
+        &container, "container", "c", "", "The container to attach to",
+    )
+    cmd.Flags().BoolVarP(
+        &stdin, "stdin", "i", false, "Pass stdin to the container",
+    )
+    cmd.Flags().BoolVarP(
+        &tty, "tty", "t", false, "Stdin is a TTY",
+    )
+    addRecordFlag(cmd, &record)
+    return cmd
+}
+
+func (sv *dshCmd) attachPod(
+    kcontext string, namespace string, ds string, nodeName string,
+    container string, stdin bool, tty bool, record string,
+) error {
+    if nodeName == "" {
+        return fmt.Errorf("-N is required")
+    }
+
+    clientset, config, err := getClientSet(kcontext)
+    if err != nil {
+        return err
+    }
+    err = preflight(clientset, namespace, permListPods, permAttach)
+    if err != nil {
+        return err
+    }
+
+    pods, err := getPodsForDaemonSet(clientset, ds, namespace, nodeName)
+    if err != nil {
+        return err
+    }
+
+    if len(pods) == 0 {
+        fmt.Printf("No pods found\n")
+        return nil
+    }
+
+    if len(pods) > 1 {
+        fmt.Printf("More than one pod found, wut?!")
+        return nil
+    }
+
+    pod := &pods[0]
+    if container == "" {
+        container = pod.Spec.Containers[0].Name
+    }
+    found := false
+    for _, c := range pod.Spec.Containers {
+        if c.Name != container {
+            continue
+        }
+        found = true
+        if stdin && !c.Stdin {
+            return fmt.Errorf(
+                "container %s wasn't started with stdin, so -i won't work",
+                container,
+            )
+        }
+        if tty && !c.TTY {
+            fmt.Fprintf(
+                os.Stderr,
+                "Unable to use a TTY - container %s did not allocate one\n",
+                container,
+            )
+            tty = false
+        }
+    }
+    if !found {
+        return fmt.Errorf("pod %s has no container %s", pod.Name, container)
+    }
+
+    var streamOptions remotecommand.StreamOptions
+    if tty && stdin {
+        var restore func()
+        streamOptions, restore, err = ttyStreamOptions()
+        if err != nil {
+            return err
+        }
+        defer restore()
+        fmt.Fprintf(
+            os.Stderr,
+            "If you don't see a command prompt, try pressing enter.\r\n",
+        )
+    } else {
+        streamOptions = remotecommand.StreamOptions{
+            Stdout: os.Stdout,
+            Stderr: os.Stderr,
+            Tty:    tty,
+        }
+        if stdin {
+            streamOptions.Stdin = os.Stdin
+        }
+    }
+
+    stopRecording, err := startRecording(
+        &sv.config.Record, kcontext, record, pod, container, nil, &streamOptions,
+    )
+    if err != nil {
+        return err
+    }
+    defer stopRecording()
+
+    err = streamAttach(
+        context.TODO(), clientset, config, namespace, pod.Name, container,
+        streamOptions,
+    )
+    auditPod("attach", pod, err)
+    return err
+}
@@ -0,0 +1,194 @@
+package cmd
+
+import (
+    "bufio"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "github.com/spf13/cobra"
+    "io"
+    "io/fs"
+    "os"
+    "time"
+
+    "k8s.io/cli-runtime/pkg/printers"
+)
+
+// auditQuery is what audit looks for in the audit log
+type auditQuery struct {
+    ds       string
+    nodeName string
+    since    time.Time
+    until    time.Time
+}
+
+func newDshAuditCommand(
+    out io.Writer, context *string, namespace *string, nodeName *string,
+    config *dshConfig,
+) *cobra.Command {
+    var since, until, output string
+
+    dshAudit := &dshCmd{
+        out:    out,
+        config: config,
+    }
+
+    cmd := &cobra.Command{
+        Use:   "audit [<daemonset>] [<options>]",
+        Short: "show what was done to daemons, and by who",
+        Long:
+`Shows entries from the audit log, which records everything the commands
+that change things do: who deleted, restarted, exec'd into or copied from
+which pod, when, from which context, and how it went. Each command also gets
+an entry of its own for how it went overall.
+
+Entries can be limited to a daemonset (<name> or <namespace>/<name>), a node
+(-N), and a time range. --since and --until take a time, like 2024-05-01 or
+2024-05-01T14:00:00Z, or a duration ago, like 2h.
+
+The log is ~/.kube/kubectl-daemons/audit.jsonl, unless audit.path in the
+config file says otherwise.`,
+        Args: cobra.MatchAll(cobra.MaximumNArgs(1)),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            query := auditQuery{nodeName: *nodeName}
+            if len(args) == 1 {
+                query.ds = args[0]
+            }
+            var err error
+            now := time.Now()
+            if query.since, err = parseAuditTime(since, now); err != nil {
+                return fmt.Errorf("bad --since: %w", err)
+            }
+            if query.until, err = parseAuditTime(until, now); err != nil {
+                return fmt.Errorf("bad --until: %w", err)
+            }
+            switch output {
+            case "", "json":
+            default:
+                return fmt.Errorf("-o must be json, not %q", output)
+            }
+            return dshAudit.audit(query, output)
+        },
+    }
+
+    cmd.Flags().StringVar(
+        &since, "since", "", "Only entries from this time on",
+    )
+    cmd.Flags().StringVar(
+        &until, "until", "", "Only entries from before this time",
+    )
+    cmd.Flags().StringVarP(
+        &output, "output", "o", "", "Output format, json for JSON lines",
+    )
+    return cmd
+}
+
+func (sv *dshCmd) audit(query auditQuery, output string) error {
+    path := sv.config.Audit.auditPath()
+    file, err := os.Open(path)
+    if errors.Is(err, fs.ErrNotExist) {
+        fmt.Printf("No audit log at %s yet\n", path)
+        return nil
+    }
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+
+    var entries []auditEntry
+    scanner := bufio.NewScanner(file)
+    scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+    line := 0
+    for scanner.Scan() {
+        line++
+        var entry auditEntry
+        if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+            return fmt.Errorf("%s line %d: %w", path, line, err)
+        }
+        if !query.matches(&entry) {
+            continue
+        }
+        if output == "json" {
+            fmt.Fprintf(sv.out, "%s\n", scanner.Bytes())
+            continue
+        }
+        entries = append(entries, entry)
+    }
+    if err := scanner.Err(); err != nil {
+        return err
+    }
+    if output == "json" {
+        return nil
+    }
+
+    if len(entries) == 0 {
+        fmt.Printf("No entries found\n")
+        return nil
+    }
+    w := printers.GetNewTabWriter(sv.out)
+    fmt.Fprintln(
+        w, "TIME\tUSER\tKUBE USER\tCONTEXT\tACTION\tDAEMONSET\tNODE\tPOD\t" +
+        "OUTCOME",
+    )
+    for _, e := range entries {
+        ds := ""
+        if e.DaemonSet != "" {
+            ds = e.Namespace + "/" + e.DaemonSet
+        }
+        outcome := e.Outcome
+        if e.Error != "" {
+            outcome += ": " + e.Error
+        }
+        fmt.Fprintf(
+            w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+            e.Time.Local().Format(time.DateTime), orNone(e.User),
+            orNone(e.KubeUser), orNone(e.Context), e.Action, orNone(ds),
+            orNone(e.Node), orNone(e.Pod), outcome,
+        )
+    }
+    return w.Flush()
+}
+
+func (q *auditQuery) matches(e *auditEntry) bool {
+    if q.ds != "" && q.ds != e.DaemonSet &&
+        q.ds != e.Namespace+"/"+e.DaemonSet {
+        return false
+    }
+    if q.nodeName != "" && q.nodeName != e.Node {
+        return false
+    }
+    if !q.since.IsZero() && e.Time.Before(q.since) {
+        return false
+    }
+    if !q.until.IsZero() && !e.Time.Before(q.until) {
+        return false
+    }
+    return true
+}
+
+// parseAuditTime parses value as a duration before now, or a time, in
+// local time unless it says otherwise. No value is the zero time.
+func parseAuditTime(value string, now time.Time) (time.Time, error) {
+    if value == "" {
+        return time.Time{}, nil
+    }
+    if d, err := time.ParseDuration(value); err == nil {
+        return now.Add(-d), nil
+    }
+    if t, err := time.Parse(time.RFC3339, value); err == nil {
+        return t, nil
+    }
+    for _, layout := range []string{
+        time.DateTime, "2006-01-02T15:04:05", "2006-01-02 15:04",
+        time.DateOnly,
+    } {
+        t, err := time.ParseInLocation(layout, value, now.Location())
+        if err == nil {
+            return t, nil
+        }
+    }
+    return time.Time{}, fmt.Errorf(
+        "%q is neither a time, like 2024-05-01T14:00:00Z, nor a duration, " +
+        "like 2h", value,
+    )
+}
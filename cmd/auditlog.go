@@ -0,0 +1,241 @@
+package cmd
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "github.com/spf13/cobra"
+    "github.com/spf13/pflag"
+    "os"
+    "os/user"
+    "path/filepath"
+    "strings"
+    "sync"
+    "time"
+
+    authenticationv1 "k8s.io/api/authentication/v1"
+    v1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// The annotation on flags whose values may be secrets, like run-script
+// --env, so the audit log only has the NAME of a NAME=VALUE
+const auditRedactAnnotation = "kubectl-daemons/audit-redact"
+
+// auditEntry is a line in the audit log: something we did, or tried to do,
+// and who to.
+type auditEntry struct {
+    Time      time.Time `json:"time"`
+    User      string    `json:"user,omitempty"`
+    KubeUser  string    `json:"kubeUser,omitempty"`
+    Context   string    `json:"context,omitempty"`
+    Namespace string    `json:"namespace,omitempty"`
+    DaemonSet string    `json:"daemonset,omitempty"`
+    Node      string    `json:"node,omitempty"`
+    Pod       string    `json:"pod,omitempty"`
+    // What we did, like delete or exec, or for the entry at the end of a
+    // command, the command, like "d delete"
+    Action  string `json:"action"`
+    // The whole command line, with the values of flags that may be secrets
+    // redacted
+    Command string `json:"command"`
+    // ok or failed, and why
+    Outcome string `json:"outcome"`
+    Error   string `json:"error,omitempty"`
+}
+
+// auditor writes what a command does to the audit log. The policy guard
+// starts one for every command that changes things.
+type auditor struct {
+    kcontext string
+    path     string
+    command  string
+
+    mu       sync.Mutex
+    identity *auditEntry
+}
+
+// The auditor for the command we're running, if it changes things
+var currentAuditor *auditor
+
+// The command line we're running, with command aliases expanded, as Execute
+// set it, or if it didn't, os.Args
+var commandLine []string
+
+// startAudit sets up auditing for c, unless config turns it off.
+func startAudit(
+    kcontext string, c *cobra.Command, config *auditConfig,
+) *auditor {
+    if config.Disabled {
+        return nil
+    }
+    args := commandLine
+    if args == nil {
+        args = os.Args[1:]
+    }
+    currentAuditor = &auditor{
+        kcontext: kcontext,
+        path:     config.auditPath(),
+        command: strings.Join(
+            append(
+                []string{"kubectl", c.Root().Name()}, redactArgs(c, args)...,
+            ), " ",
+        ),
+    }
+    return currentAuditor
+}
+
+// redactArgs is args with the values of c's flags that have the
+// auditRedactAnnotation replaced, keeping the NAME of a NAME=VALUE.
+func redactArgs(c *cobra.Command, args []string) []string {
+    result := make([]string, len(args))
+    copy(result, args)
+    for i := 0; i < len(result); i++ {
+        arg := result[i]
+        if arg == "--" {
+            break
+        }
+        if !strings.HasPrefix(arg, "-") || arg == "-" {
+            continue
+        }
+
+        // --env VALUE, --env=VALUE, -e VALUE, -e=VALUE or -eVALUE
+        var flag *pflag.Flag
+        name, value, attached := "", "", false
+        if strings.HasPrefix(arg, "--") {
+            name, value, attached = strings.Cut(arg[2:], "=")
+            flag = c.Flags().Lookup(name)
+            name = "--" + name
+        } else {
+            name = arg[:2]
+            flag = c.Flags().ShorthandLookup(arg[1:2])
+            if attached = len(arg) > 2; attached && arg[2] == '=' {
+                name, value = arg[:3], arg[3:]
+            } else if attached {
+                value = arg[2:]
+            }
+        }
+        if flag == nil || flag.Annotations[auditRedactAnnotation] == nil {
+            continue
+        }
+        switch {
+        case attached && strings.HasPrefix(arg, "--"):
+            result[i] = name + "=" + redactValue(value)
+        case attached:
+            result[i] = name + redactValue(value)
+        case i+1 < len(result):
+            i++
+            result[i] = redactValue(result[i])
+        }
+    }
+    return result
+}
+
+// redactValue keeps only the NAME of a NAME=VALUE.
+func redactValue(value string) string {
+    if name, _, found := strings.Cut(value, "="); found {
+        return name + "=" + redacted
+    }
+    return redacted
+}
+
+// whoAmI works out, once, who we are, both locally and to the API server,
+// which may well be different to what the kubeconfig calls the user.
+func (a *auditor) whoAmI() *auditEntry {
+    if a.identity != nil {
+        return a.identity
+    }
+    a.identity = &auditEntry{}
+    if current, err := user.Current(); err == nil {
+        a.identity.User = current.Username
+    }
+    contextName, kubeUser, err := getContextInfo(a.kcontext)
+    if err == nil {
+        a.identity.Context = contextName
+        a.identity.KubeUser = kubeUser
+    }
+    clientset, _, err := getClientSet(a.kcontext)
+    if err != nil {
+        return a.identity
+    }
+    review, err := clientset.AuthenticationV1().SelfSubjectReviews().Create(
+        context.TODO(), &authenticationv1.SelfSubjectReview{},
+        metav1.CreateOptions{},
+    )
+    if err == nil && review.Status.UserInfo.Username != "" {
+        a.identity.KubeUser = review.Status.UserInfo.Username
+    }
+    return a.identity
+}
+
+// record appends entry to the audit log. Not being able to shouldn't stop
+// whatever we're doing, so we only warn about it.
+func (a *auditor) record(entry auditEntry, err error) {
+    if a == nil {
+        return
+    }
+    a.mu.Lock()
+    defer a.mu.Unlock()
+
+    identity := a.whoAmI()
+    entry.Time = time.Now().UTC()
+    entry.User = identity.User
+    entry.KubeUser = identity.KubeUser
+    entry.Context = identity.Context
+    entry.Command = a.command
+    entry.Outcome = "ok"
+    if err != nil {
+        entry.Outcome = "failed"
+        entry.Error = err.Error()
+    }
+
+    if err := a.write(&entry); err != nil {
+        fmt.Fprintf(os.Stderr, "Warning: couldn't write audit log: %v\n", err)
+    }
+}
+
+func (a *auditor) write(entry *auditEntry) error {
+    data, err := json.Marshal(entry)
+    if err != nil {
+        return err
+    }
+    if err := os.MkdirAll(filepath.Dir(a.path), 0700); err != nil {
+        return err
+    }
+    file, err := os.OpenFile(
+        a.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600,
+    )
+    if err != nil {
+        return err
+    }
+    if _, err := file.Write(append(data, '\n')); err != nil {
+        file.Close()
+        return err
+    }
+    return file.Close()
+}
+
+// finish records how the whole command went.
+func (a *auditor) finish(
+    namespace string, ds string, nodeName string, action string, err error,
+) {
+    a.record(auditEntry{
+        Namespace: namespace, DaemonSet: ds, Node: nodeName, Action: action,
+    }, err)
+}
+
+// auditPod records doing action to pod.
+func auditPod(action string, pod *v1.Pod, err error) {
+    currentAuditor.record(auditEntry{
+        Namespace: pod.Namespace,
+        DaemonSet: daemonSetOwner(pod, ""),
+        Node:      pod.Spec.NodeName,
+        Pod:       pod.Name,
+        Action:    action,
+    }, err)
+}
+
+// auditNode records doing action to the node nodeName.
+func auditNode(action string, nodeName string, err error) {
+    currentAuditor.record(auditEntry{Node: nodeName, Action: action}, err)
+}
@@ -0,0 +1,58 @@
+package cmd
+
+import (
+    "io"
+    "strings"
+    "testing"
+)
+
+func TestRedactArgs(t *testing.T) {
+    var kcontext, namespace, nodeName string
+    cmd := newDshRunScriptCommand(
+        io.Discard, &kcontext, &namespace, &nodeName,
+    )
+
+    tests := []struct {
+        args string
+        want string
+    }{
+        {
+            "agent check.sh --env TOKEN=abc -N n1",
+            "agent check.sh --env TOKEN=<redacted> -N n1",
+        },
+        {
+            "agent check.sh --env=TOKEN=abc",
+            "agent check.sh --env=TOKEN=<redacted>",
+        },
+        {
+            "agent check.sh -e TOKEN=abc -e LEVEL=debug",
+            "agent check.sh -e TOKEN=<redacted> -e LEVEL=<redacted>",
+        },
+        {"agent check.sh -e=TOKEN=abc", "agent check.sh -e=TOKEN=<redacted>"},
+        {"agent check.sh -eTOKEN=abc", "agent check.sh -eTOKEN=<redacted>"},
+        // a value without a NAME= is all secret
+        {"agent check.sh --env abc", "agent check.sh --env <redacted>"},
+        // other flags, and their values, are left alone
+        {
+            "agent check.sh -c main -p 2 --all",
+            "agent check.sh -c main -p 2 --all",
+        },
+        {"agent check.sh -c TOKEN=abc", "agent check.sh -c TOKEN=abc"},
+        // anything after -- is the script's
+        {
+            "agent check.sh -- --env TOKEN=abc",
+            "agent check.sh -- --env TOKEN=abc",
+        },
+        {"agent check.sh --env", "agent check.sh --env"},
+    }
+    for _, tt := range tests {
+        args := strings.Fields(tt.args)
+        got := redactArgs(cmd, args)
+        if strings.Join(got, " ") != tt.want {
+            t.Errorf("redactArgs(%q) = %q, want %q", tt.args, got, tt.want)
+        }
+        if strings.Join(args, " ") != tt.args {
+            t.Errorf("redactArgs(%q) changed its args to %q", tt.args, args)
+        }
+    }
+}
@@ -0,0 +1,205 @@
+package cmd
+
+import (
+    "context"
+    "fmt"
+    "github.com/spf13/cobra"
+    "io"
+    "os"
+    "strings"
+
+    authorizationv1 "k8s.io/api/authorization/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/cli-runtime/pkg/printers"
+    "k8s.io/client-go/kubernetes"
+)
+
+// permission is something we may need to be allowed to do
+type permission struct {
+    verb        string
+    group       string
+    resource    string
+    subresource string
+    // Whether it's about something cluster-wide, like nodes
+    clusterScoped bool
+}
+
+func (p permission) String() string {
+    resource := p.resource
+    if p.subresource != "" {
+        resource += "/" + p.subresource
+    }
+    if p.group != "" {
+        resource += "." + p.group
+    }
+    return p.verb + " " + resource
+}
+
+var (
+    permGetPods    = permission{verb: "get", resource: "pods"}
+    permListPods   = permission{verb: "list", resource: "pods"}
+    permCreatePods = permission{verb: "create", resource: "pods"}
+    permDeletePods = permission{verb: "delete", resource: "pods"}
+    permGetLogs    = permission{
+        verb: "get", resource: "pods", subresource: "log",
+    }
+    permExec = permission{
+        verb: "create", resource: "pods", subresource: "exec",
+    }
+    permAttach = permission{
+        verb: "create", resource: "pods", subresource: "attach",
+    }
+    permEvict = permission{
+        verb: "create", resource: "pods", subresource: "eviction",
+    }
+    // UpdateEphemeralContainers is a PUT, which RBAC checks as update
+    permUpdateEphemeral = permission{
+        verb: "update", resource: "pods", subresource: "ephemeralcontainers",
+    }
+    permPatchDaemonSets = permission{
+        verb: "patch", group: "apps", resource: "daemonsets",
+    }
+    permGetNodes = permission{
+        verb: "get", resource: "nodes", clusterScoped: true,
+    }
+    permPatchNodes = permission{
+        verb: "patch", resource: "nodes", clusterScoped: true,
+    }
+)
+
+// The permissions can-i checks
+var canIPermissions = []permission{
+    permGetPods,
+    permListPods,
+    permGetLogs,
+    permExec,
+    permEvict,
+    permDeletePods,
+    permPatchDaemonSets,
+    permGetNodes,
+}
+
+func newDshCanICommand(
+    out io.Writer, context *string, namespace *string, nodeName *string,
+) *cobra.Command {
+    dshCanI := &dshCmd{
+        out: out,
+    }
+
+    cmd := &cobra.Command{
+        Use:   "can-i [<namespace>...]",
+        Short: "show what you're allowed to do with daemons",
+        Long:
+`Shows what the current identity is allowed to do, for each of the things
+this plugin does, in the namespaces given (by default, the one from -n).
+Cluster-wide permissions, like getting nodes, are the same in every
+namespace.
+
+Commands that change things check the permissions they need the same way
+before doing anything, so they fail up front rather than halfway through.`,
+        RunE: func(cmd *cobra.Command, args []string) error {
+            namespaces := args
+            if len(namespaces) == 0 {
+                namespaces = []string{*namespace}
+            }
+            return dshCanI.canI(*context, namespaces)
+        },
+    }
+
+    return cmd
+}
+
+func (sv *dshCmd) canI(kcontext string, namespaces []string) error {
+    clientset, _, err := getClientSet(kcontext)
+    if err != nil {
+        return err
+    }
+
+    w := printers.GetNewTabWriter(sv.out)
+    // namespaces are case-sensitive, so unlike the other headers, they
+    // stay as they are
+    fmt.Fprintf(w, "PERMISSION\t%s\n", strings.Join(namespaces, "\t"))
+    for _, perm := range canIPermissions {
+        fmt.Fprintf(w, "%s", perm)
+        var clusterAllowed string
+        for _, ns := range namespaces {
+            if perm.clusterScoped && clusterAllowed != "" {
+                fmt.Fprintf(w, "\t%s", clusterAllowed)
+                continue
+            }
+            allowed, err := checkPermission(clientset, ns, perm)
+            if err != nil {
+                return err
+            }
+            answer := "no"
+            if allowed {
+                answer = "yes"
+            }
+            if perm.clusterScoped {
+                clusterAllowed = answer
+            }
+            fmt.Fprintf(w, "\t%s", answer)
+        }
+        fmt.Fprintln(w)
+    }
+    return w.Flush()
+}
+
+// checkPermission asks the API server whether we may do perm in namespace.
+func checkPermission(
+    clientset *kubernetes.Clientset, namespace string, perm permission,
+) (bool, error) {
+    attrs := &authorizationv1.ResourceAttributes{
+        Verb:        perm.verb,
+        Group:       perm.group,
+        Resource:    perm.resource,
+        Subresource: perm.subresource,
+    }
+    if !perm.clusterScoped {
+        attrs.Namespace = namespace
+    }
+    reviews := clientset.AuthorizationV1().SelfSubjectAccessReviews()
+    review, err := reviews.Create(
+        context.TODO(), &authorizationv1.SelfSubjectAccessReview{
+            Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+                ResourceAttributes: attrs,
+            },
+        }, metav1.CreateOptions{},
+    )
+    if err != nil {
+        return false, fmt.Errorf("checking if we can %s: %w", perm, err)
+    }
+    return review.Status.Allowed, nil
+}
+
+// preflight makes sure we're allowed to do everything in perms in namespace
+// ("" being all of them) before a command changes anything. If we can't even
+// ask, we warn and carry on, and let the API server be the judge.
+func preflight(
+    clientset *kubernetes.Clientset, namespace string, perms ...permission,
+) error {
+    var denied []string
+    for _, perm := range perms {
+        allowed, err := checkPermission(clientset, namespace, perm)
+        if err != nil {
+            fmt.Fprintf(
+                os.Stderr, "Warning: couldn't check permissions: %v\n", err,
+            )
+            return nil
+        }
+        if !allowed {
+            denied = append(denied, perm.String())
+        }
+    }
+    if len(denied) == 0 {
+        return nil
+    }
+    where := fmt.Sprintf("namespace %s", namespace)
+    if namespace == "" {
+        where = "all namespaces"
+    }
+    return fmt.Errorf(
+        "not allowed to %s in %s, see kubectl d can-i",
+        strings.Join(denied, ", "), where,
+    )
+}
@@ -0,0 +1,301 @@
+package cmd
+
+import (
+    "context"
+    "fmt"
+    "github.com/spf13/cobra"
+    "io"
+    "sort"
+    "strings"
+
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/util/sets"
+    "k8s.io/client-go/tools/clientcmd"
+)
+
+// The annotation on commands that take a node as their argument, so it can
+// be completed
+const nodeArgAnnotation = "kubectl-daemons/node-arg"
+
+func newCompletionCommand(out io.Writer) *cobra.Command {
+    cmd := &cobra.Command{
+        Use:   "completion bash|zsh|fish|powershell",
+        Short: "print a shell completion script for kubectl-d",
+        Long:
+`Prints a script that completes daemonsets, nodes, containers, contexts and
+namespaces when running kubectl-d directly. For example, for bash:
+
+  source <(kubectl-d completion bash)
+
+For 'kubectl d', put the kubectl_complete-d script that comes with
+kubectl-daemons in your PATH instead, which kubectl 1.26 and later use to
+complete plugins.`,
+        Args: cobra.MatchAll(
+            cobra.ExactArgs(1), cobra.OnlyValidArgs,
+        ),
+        ValidArgs: []string{"bash", "zsh", "fish", "powershell"},
+        RunE: func(cmd *cobra.Command, args []string) error {
+            // the scripts are for the name we're run by, not the one we go
+            // by as a kubectl plugin
+            root := cmd.Root()
+            root.Use = "kubectl-d"
+            switch args[0] {
+            case "bash":
+                return root.GenBashCompletionV2(out, true)
+            case "zsh":
+                return root.GenZshCompletion(out)
+            case "fish":
+                return root.GenFishCompletion(out, true)
+            case "powershell":
+                return root.GenPowerShellCompletionWithDesc(out)
+            }
+            return fmt.Errorf("unknown shell %s", args[0])
+        },
+    }
+
+    return cmd
+}
+
+// completer completes daemonsets, nodes, containers, contexts and
+// namespaces for the shell, from the cluster and the kubeconfig.
+type completer struct {
+    config    *dshConfig
+    context   *string
+    namespace *string
+}
+
+// register sets up completion for root's flags and its commands' arguments
+// and flags.
+func (c *completer) register(root *cobra.Command) {
+    root.RegisterFlagCompletionFunc("context", c.contexts)
+    root.RegisterFlagCompletionFunc("namespace", c.namespaces)
+    root.RegisterFlagCompletionFunc("node", c.nodes)
+
+    for _, cmd := range root.Commands() {
+        if cmd.ValidArgsFunction == nil {
+            switch kind := cmd.Annotations[daemonSetArgAnnotation]; {
+            case kind == "copy":
+                cmd.ValidArgsFunction = c.copyArgs
+            case kind != "":
+                cmd.ValidArgsFunction = c.daemonSetArg
+            case cmd.Annotations[nodeArgAnnotation] == "true":
+                cmd.ValidArgsFunction = c.nodeArg
+            }
+        }
+        if cmd.Flags().Lookup("container") != nil {
+            cmd.RegisterFlagCompletionFunc("container", c.containers)
+        }
+    }
+}
+
+// target works out the context, namespace and daemonset a command line is
+// about so far, defaults and aliases included.
+func (c *completer) target(
+    cmd *cobra.Command, args []string,
+) (string, string, string) {
+    namespace := *c.namespace
+    args = append([]string{}, args...)
+    if c.config != nil {
+        c.config.applyDefaults(cmd, args, *c.context, &namespace)
+    }
+
+    return *c.context, namespace, argDaemonSet(cmd, args)
+}
+
+func (c *completer) daemonSetArg(
+    cmd *cobra.Command, args []string, toComplete string,
+) ([]string, cobra.ShellCompDirective) {
+    if len(args) > 0 {
+        return nil, cobra.ShellCompDirectiveNoFileComp
+    }
+    prefix := ""
+    if ds, ok := parseDaemonSetArg(toComplete); ok {
+        prefix = toComplete[:len(toComplete)-len(ds)]
+    }
+    return withPrefix(c.daemonSetNames(cmd, args), prefix, toComplete),
+        cobra.ShellCompDirectiveNoFileComp
+}
+
+// copyArgs completes <daemonset>: for the remote side of a copy, and files
+// for the local side.
+func (c *completer) copyArgs(
+    cmd *cobra.Command, args []string, toComplete string,
+) ([]string, cobra.ShellCompDirective) {
+    if len(args) >= 2 || strings.ContainsAny(toComplete, `:/\`) {
+        return nil, cobra.ShellCompDirectiveDefault
+    }
+    var completions []string
+    for _, ds := range c.daemonSetNames(cmd, args) {
+        if strings.HasPrefix(ds, toComplete) {
+            completions = append(completions, ds+":")
+        }
+    }
+    if len(completions) == 0 {
+        return nil, cobra.ShellCompDirectiveDefault
+    }
+    return completions, cobra.ShellCompDirectiveNoSpace
+}
+
+// daemonSetNames is the daemonsets in the namespace, or if there's a node,
+// those on it, and the aliases in the config file.
+func (c *completer) daemonSetNames(
+    cmd *cobra.Command, args []string,
+) []string {
+    kcontext, namespace, _ := c.target(cmd, args)
+    names := sets.New[string]()
+    if c.config != nil {
+        for alias := range c.config.Aliases.DaemonSets {
+            names.Insert(alias)
+        }
+    }
+    clientset, _, err := getClientSet(kcontext)
+    if err != nil {
+        return sets.List(names)
+    }
+    nodeName := cmd.Flag("node").Value.String()
+    if nodeName != "" {
+        daemonSets, err := getDaemonSetsForNode(
+            clientset, namespace, nodeName,
+        )
+        if err == nil {
+            names.Insert(daemonSets...)
+        }
+        return sets.List(names)
+    }
+    dsList, err := clientset.AppsV1().DaemonSets(namespace).List(
+        context.TODO(), metav1.ListOptions{},
+    )
+    if err == nil {
+        for _, ds := range dsList.Items {
+            names.Insert(ds.Name)
+        }
+    }
+    return sets.List(names)
+}
+
+func (c *completer) nodeArg(
+    cmd *cobra.Command, args []string, toComplete string,
+) ([]string, cobra.ShellCompDirective) {
+    if len(args) > 0 {
+        return nil, cobra.ShellCompDirectiveNoFileComp
+    }
+    return c.nodes(cmd, args, toComplete)
+}
+
+// nodes completes node names, only those running the daemonset, if there is
+// one.
+func (c *completer) nodes(
+    cmd *cobra.Command, args []string, toComplete string,
+) ([]string, cobra.ShellCompDirective) {
+    kcontext, namespace, ds := c.target(cmd, args)
+    clientset, _, err := getClientSet(kcontext)
+    if err != nil {
+        return nil, cobra.ShellCompDirectiveError
+    }
+
+    names := sets.New[string]()
+    if ds != "" {
+        pods, err := getPodsForDaemonSet(clientset, ds, namespace, "")
+        if err != nil {
+            return nil, cobra.ShellCompDirectiveError
+        }
+        for _, pod := range pods {
+            names.Insert(pod.Spec.NodeName)
+        }
+    } else {
+        nodes, err := clientset.CoreV1().Nodes().List(
+            context.TODO(), metav1.ListOptions{},
+        )
+        if err != nil {
+            return nil, cobra.ShellCompDirectiveError
+        }
+        for _, node := range nodes.Items {
+            names.Insert(node.Name)
+        }
+    }
+    return withPrefix(sets.List(names), "", toComplete),
+        cobra.ShellCompDirectiveNoFileComp
+}
+
+// containers completes the containers in the daemonset's pods.
+func (c *completer) containers(
+    cmd *cobra.Command, args []string, toComplete string,
+) ([]string, cobra.ShellCompDirective) {
+    kcontext, namespace, ds := c.target(cmd, args)
+    if ds == "" {
+        return nil, cobra.ShellCompDirectiveNoFileComp
+    }
+    clientset, _, err := getClientSet(kcontext)
+    if err != nil {
+        return nil, cobra.ShellCompDirectiveError
+    }
+    daemonSet, err := clientset.AppsV1().DaemonSets(namespace).Get(
+        context.TODO(), ds, metav1.GetOptions{},
+    )
+    if err != nil {
+        return nil, cobra.ShellCompDirectiveError
+    }
+    var names []string
+    for _, container := range daemonSet.Spec.Template.Spec.Containers {
+        names = append(names, container.Name)
+    }
+    for _, container := range daemonSet.Spec.Template.Spec.InitContainers {
+        names = append(names, container.Name)
+    }
+    return withPrefix(names, "", toComplete),
+        cobra.ShellCompDirectiveNoFileComp
+}
+
+// contexts completes the contexts in the kubeconfig.
+func (c *completer) contexts(
+    cmd *cobra.Command, args []string, toComplete string,
+) ([]string, cobra.ShellCompDirective) {
+    rawConfig, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+        clientcmd.NewDefaultClientConfigLoadingRules(),
+        &clientcmd.ConfigOverrides{},
+    ).RawConfig()
+    if err != nil {
+        return nil, cobra.ShellCompDirectiveError
+    }
+    var names []string
+    for name := range rawConfig.Contexts {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return withPrefix(names, "", toComplete),
+        cobra.ShellCompDirectiveNoFileComp
+}
+
+// namespaces completes the namespaces in the cluster.
+func (c *completer) namespaces(
+    cmd *cobra.Command, args []string, toComplete string,
+) ([]string, cobra.ShellCompDirective) {
+    clientset, _, err := getClientSet(*c.context)
+    if err != nil {
+        return nil, cobra.ShellCompDirectiveError
+    }
+    namespaces, err := clientset.CoreV1().Namespaces().List(
+        context.TODO(), metav1.ListOptions{},
+    )
+    if err != nil {
+        return nil, cobra.ShellCompDirectiveError
+    }
+    var names []string
+    for _, ns := range namespaces.Items {
+        names = append(names, ns.Name)
+    }
+    return withPrefix(names, "", toComplete),
+        cobra.ShellCompDirectiveNoFileComp
+}
+
+// withPrefix is the names that, with prefix, start with toComplete, with
+// prefix.
+func withPrefix(names []string, prefix string, toComplete string) []string {
+    var completions []string
+    for _, name := range names {
+        if strings.HasPrefix(prefix+name, toComplete) {
+            completions = append(completions, prefix+name)
+        }
+    }
+    return completions
+}
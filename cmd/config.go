@@ -0,0 +1,161 @@
+package cmd
+
+import (
+    "errors"
+    "fmt"
+    "io/fs"
+    "os"
+    "path/filepath"
+
+    "k8s.io/client-go/util/homedir"
+    "sigs.k8s.io/yaml"
+)
+
+// The environment variable that points to a config file other than the
+// default ~/.kube/kubectl-daemons.yaml
+const configEnvVar = "KUBECTL_DAEMONS_CONFIG"
+
+// dshConfig is the config file. Everything in it is optional.
+type dshConfig struct {
+    Defaults defaultsConfig `json:"defaults"`
+    Aliases aliasesConfig `json:"aliases"`
+    Record recordConfig `json:"record"`
+    Delete deleteConfig `json:"delete"`
+    Maintain maintainConfig `json:"maintain"`
+    Restart restartConfig `json:"restart"`
+    Policy policyConfig `json:"policy"`
+    Audit auditConfig `json:"audit"`
+}
+
+type defaultsConfig struct {
+    // The namespace to use in each context, by context name, without -n
+    Namespaces map[string]string `json:"namespaces,omitempty"`
+    // The container to use for each daemonset, by <name> or
+    // <namespace>/<name>, without -c
+    Containers map[string]string `json:"containers,omitempty"`
+}
+
+type aliasesConfig struct {
+    // Short names for daemonsets, standing for <name> or <namespace>/<name>
+    DaemonSets map[string]string `json:"daemonsets,omitempty"`
+    // Commands of our own, standing for a command and its options, like
+    // "bounce: delete --evict --wait"
+    Commands map[string]string `json:"commands,omitempty"`
+}
+
+type recordConfig struct {
+    // Record every exec, attach and debug session, as if --record was given
+    Always bool `json:"always"`
+    // Where sessions go when Always is set, by default
+    // ~/.kube/kubectl-daemons/recordings
+    Dir string `json:"dir,omitempty"`
+}
+
+type deleteConfig struct {
+    // Ask before deleting more than this many pods, by default 1
+    ConfirmAbove int `json:"confirmAbove,omitempty"`
+    // Never delete more than this many pods at once, by default 50, and
+    // negative for no limit
+    MaxPods int `json:"maxPods,omitempty"`
+}
+
+// The most pods delete deletes at once, unless told otherwise
+const defaultMaxPods = 50
+
+type maintainConfig struct {
+    // Daemonsets to restart first in maintain restart-daemons and
+    // restart-node, in order, as <name> or <namespace>/<name>, where their
+    // dependencies allow
+    RestartOrder []string `json:"restartOrder,omitempty"`
+}
+
+type restartConfig struct {
+    // The daemonsets each daemonset must be restarted after, by <name> or
+    // <namespace>/<name>
+    After map[string][]string `json:"after,omitempty"`
+}
+
+type policyConfig struct {
+    // Refuse to run anything that changes things, as if --read-only was given
+    ReadOnly bool `json:"readOnly"`
+    Protected protectedConfig `json:"protected"`
+    // Daemonsets, by <name> or <namespace>/<name>, whose pods may only be
+    // deleted a node at a time
+    NeverBulkDelete []string `json:"neverBulkDelete,omitempty"`
+}
+
+// protectedConfig lists where commands that change things need the context
+// name typed in first. Both can be patterns, like prod-*.
+type protectedConfig struct {
+    Contexts []string `json:"contexts,omitempty"`
+    Namespaces []string `json:"namespaces,omitempty"`
+}
+
+type auditConfig struct {
+    // Don't keep an audit log
+    Disabled bool `json:"disabled"`
+    // Where the audit log goes, by default
+    // ~/.kube/kubectl-daemons/audit.jsonl
+    Path string `json:"path,omitempty"`
+}
+
+func configPath() string {
+    if path := os.Getenv(configEnvVar); path != "" {
+        return path
+    }
+    return filepath.Join(homedir.HomeDir(), ".kube", "kubectl-daemons.yaml")
+}
+
+// loadConfig reads the config file. Not having one is fine, but a typo in
+// one isn't, since it may well be a policy someone expects us to enforce.
+func loadConfig() (*dshConfig, error) {
+    config := &dshConfig{}
+    path := configPath()
+    data, err := os.ReadFile(path)
+    if errors.Is(err, fs.ErrNotExist) {
+        return config, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+    if err := yaml.UnmarshalStrict(data, config); err != nil {
+        return nil, fmt.Errorf("reading %s: %w", path, err)
+    }
+    return config, nil
+}
+
+// maxPods is the most pods delete may delete at once, 0 being no limit.
+func (c *deleteConfig) maxPods() int {
+    switch {
+    case c.MaxPods < 0:
+        return 0
+    case c.MaxPods > 0:
+        return c.MaxPods
+    }
+    return defaultMaxPods
+}
+
+func (c *deleteConfig) confirmAbove() int {
+    if c.ConfirmAbove > 0 {
+        return c.ConfirmAbove
+    }
+    return 1
+}
+
+func (c *recordConfig) recordDir() string {
+    if c.Dir != "" {
+        return c.Dir
+    }
+    return filepath.Join(
+        homedir.HomeDir(), ".kube", "kubectl-daemons", "recordings",
+    )
+}
+
+func (c *auditConfig) auditPath() string {
+    if c.Path != "" {
+        return c.Path
+    }
+    return filepath.Join(
+        homedir.HomeDir(), ".kube", "kubectl-daemons", "audit.jsonl",
+    )
+}
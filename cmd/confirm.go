@@ -0,0 +1,49 @@
+package cmd
+
+import (
+    "bufio"
+    "fmt"
+    "io"
+    "os"
+    "strings"
+
+    "golang.org/x/term"
+)
+
+// confirm asks the user prompt on the terminal and says whether they said
+// yes. Without a terminal to ask on, the answer is no, and what to do about
+// it is up to the caller.
+func confirm(out io.Writer, prompt string) (bool, error) {
+    if !isTerminal() {
+        return false, nil
+    }
+    fmt.Fprintf(out, "%s [y/N]: ", prompt)
+    answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+    if err != nil && err != io.EOF {
+        return false, err
+    }
+    switch strings.ToLower(strings.TrimSpace(answer)) {
+    case "y", "yes":
+        return true, nil
+    }
+    return false, nil
+}
+
+// confirmTyped has the user type want to confirm prompt, for things that
+// deserve more than a y. Like confirm, without a terminal, the answer is no.
+func confirmTyped(out io.Writer, prompt string, want string) (bool, error) {
+    if !isTerminal() {
+        return false, nil
+    }
+    fmt.Fprintf(out, "%s: ", prompt)
+    answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+    if err != nil && err != io.EOF {
+        return false, err
+    }
+    return strings.TrimSpace(answer) == want, nil
+}
+
+// isTerminal says whether stdin is a terminal we can ask questions on.
+func isTerminal() bool {
+    return term.IsTerminal(int(os.Stdin.Fd()))
+}
@@ -0,0 +1,385 @@
+package cmd
+
+import (
+    "archive/tar"
+    "bytes"
+    "errors"
+    "fmt"
+    "github.com/spf13/cobra"
+    "io"
+    "os"
+    "path"
+    "path/filepath"
+    "sort"
+    "strings"
+
+    "k8s.io/client-go/kubernetes"
+    "k8s.io/client-go/rest"
+    "k8s.io/client-go/tools/remotecommand"
+)
+
+func newDshCpCommand(
+    out io.Writer, context *string, namespace *string, nodeName *string,
+) *cobra.Command {
+    var container string
+
+    dshCp := &dshCmd{
+        out: out,
+    }
+
+    cmd := &cobra.Command{
+        Use:   "cp <daemonset>:<path> <local path> | <local path> <daemonset>:<path>",
+        Short: "copy files to and from the pod for <daemonset>",
+        Long:
+`Copies files and directories to or from the pod of the specified daemonset on
+the specified node, the same way 'kubectl cp' does, which means 'tar' has to
+be available in the container. For example:
+
+kubectl d cp my-daemonset:/var/log/agent.log agent.log -N my-node
+kubectl d cp agent.yaml my-daemonset:/etc/agent/agent.yaml -N my-node
+
+When copying to the pod, a <path> ending in '/' is a directory to copy into.
+
+When copying from the pod without a node, the path is copied from every node
+into a directory per node under <local path>, so
+
+kubectl d cp my-daemonset:/var/log/agent.log logs
+
+gives you logs/<node>/agent.log for each node.`,
+        Annotations: map[string]string{daemonSetArgAnnotation: "copy"},
+        Args: cobra.MatchAll(cobra.ExactArgs(2)),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            srcDs, srcPath, srcRemote := parseCopyArg(args[0])
+            dstDs, dstPath, dstRemote := parseCopyArg(args[1])
+            switch {
+            case srcRemote && dstRemote:
+                return errors.New("can't copy from one pod to another")
+            case srcRemote:
+                return dshCp.copyFromPods(
+                    *context, *namespace, srcDs, *nodeName, container,
+                    srcPath, dstPath,
+                )
+            case dstRemote:
+                return dshCp.copyToPod(
+                    *context, *namespace, dstDs, *nodeName, container,
+                    srcPath, dstPath,
+                )
+            }
+            return errors.New(
+                "one of the paths has to be in the pod, as <daemonset>:<path>",
+            )
+        },
+    }
+
+    cmd.Flags().StringVarP(
+        &container, "container", "c", "", "The container to copy to or from",
+    )
+    return cmd
+}
+
+// parseCopyArg splits a <daemonset>:<path> argument. Anything else, including
+// a local path that happens to have a ':' in it after a '/', is local.
+func parseCopyArg(arg string) (string, string, bool) {
+    ds, remotePath, found := strings.Cut(arg, ":")
+    if !found || ds == "" || strings.ContainsAny(ds, `/\`) {
+        return "", arg, false
+    }
+    return ds, remotePath, true
+}
+
+// copyFromPods copies remotePath out of the pod on nodeName to localPath, or
+// with no node, out of every pod to a directory per node under localPath.
+func (sv *dshCmd) copyFromPods(
+    kcontext string, namespace string, ds string, nodeName string,
+    container string, remotePath string, localPath string,
+) error {
+    clientset, config, err := getClientSet(kcontext)
+    if err != nil {
+        return err
+    }
+    err = preflight(clientset, namespace, permListPods, permExec)
+    if err != nil {
+        return err
+    }
+
+    pods, err := getPodsForDaemonSet(clientset, ds, namespace, nodeName)
+    if err != nil {
+        return err
+    }
+
+    if len(pods) == 0 {
+        fmt.Printf("No pods found\n")
+        return nil
+    }
+
+    if nodeName != "" {
+        if len(pods) > 1 {
+            fmt.Printf("More than one pod found, wut?!")
+            return nil
+        }
+        err := copyFromPod(
+            clientset, config, namespace, pods[0].Name, container, remotePath,
+            localPath,
+        )
+        auditPod("cp", &pods[0], err)
+        return err
+    }
+
+    sort.Slice(pods, func(i, j int) bool {
+        return pods[i].Spec.NodeName < pods[j].Spec.NodeName
+    })
+    failed := 0
+    for _, pod := range pods {
+        nodeDir := filepath.Join(localPath, pod.Spec.NodeName)
+        if err := os.MkdirAll(nodeDir, 0755); err != nil {
+            return err
+        }
+        err := copyFromPod(
+            clientset, config, namespace, pod.Name, container, remotePath,
+            nodeDir,
+        )
+        auditPod("cp", &pod, err)
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "%s: %v\n", pod.Spec.NodeName, err)
+            failed++
+            continue
+        }
+        fmt.Fprintf(sv.out, "%s: copied to %s\n", pod.Spec.NodeName, nodeDir)
+    }
+    if failed > 0 {
+        return fmt.Errorf("copy failed on %d of %d nodes", failed, len(pods))
+    }
+    return nil
+}
+
+func copyFromPod(
+    clientset *kubernetes.Clientset, config *rest.Config, namespace string,
+    pod string, container string, remotePath string, localPath string,
+) error {
+    remotePath = path.Clean(remotePath)
+    dir, base := path.Split(remotePath)
+    if base == "" || base == "/" {
+        dir, base = "/", "."
+    }
+    if dir == "" {
+        dir = "."
+    }
+
+    // like cp, copying into an existing directory puts the copy in it
+    info, err := os.Stat(localPath)
+    if err == nil && info.IsDir() && base != "." {
+        localPath = filepath.Join(localPath, base)
+    }
+
+    reader, writer := io.Pipe()
+    var stderr bytes.Buffer
+    go func() {
+        err := streamExec(
+            clientset, config, namespace, pod, container,
+            []string{"tar", "cf", "-", "-C", dir, base},
+            remotecommand.StreamOptions{Stdout: writer, Stderr: &stderr},
+        )
+        if err != nil && stderr.Len() > 0 {
+            err = fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+        }
+        writer.CloseWithError(err)
+    }()
+    err = untar(reader, base, localPath)
+    // drain whatever is left so the exec can finish
+    io.Copy(io.Discard, reader)
+    return err
+}
+
+// untar writes the entries of the archive under prefix to dest, which takes
+// the place of prefix. Nothing is written outside of dest: entries that
+// would escape it are an error, and symlinks are skipped, so no entry can be
+// written through one.
+func untar(r io.Reader, prefix string, dest string) error {
+    tr := tar.NewReader(r)
+    found := false
+    for {
+        header, err := tr.Next()
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return err
+        }
+
+        name := path.Clean(header.Name)
+        var rel string
+        switch {
+        case prefix == ".":
+            rel = name
+        case name == prefix:
+            rel = "."
+        case strings.HasPrefix(name, prefix+"/"):
+            rel = strings.TrimPrefix(name, prefix+"/")
+        default:
+            return fmt.Errorf("unexpected file %q in archive", header.Name)
+        }
+        if rel != "." && !filepath.IsLocal(filepath.FromSlash(rel)) {
+            return fmt.Errorf(
+                "refusing to write %q outside of %s", header.Name, dest,
+            )
+        }
+        found = true
+        target := filepath.Join(dest, filepath.FromSlash(rel))
+        mode := os.FileMode(header.Mode).Perm()
+
+        switch header.Typeflag {
+        case tar.TypeDir:
+            if err := os.MkdirAll(target, mode|0700); err != nil {
+                return err
+            }
+        case tar.TypeReg:
+            if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+                return err
+            }
+            f, err := os.OpenFile(
+                target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode,
+            )
+            if err != nil {
+                return err
+            }
+            _, err = io.Copy(f, tr)
+            if closeErr := f.Close(); err == nil {
+                err = closeErr
+            }
+            if err != nil {
+                return err
+            }
+        case tar.TypeSymlink:
+            // like kubectl cp, symlinks are never written: one that's fine on
+            // its own can still lead a later entry out of dest
+            fmt.Fprintf(
+                os.Stderr, "skipping symlink %s -> %s\n", header.Name,
+                header.Linkname,
+            )
+        default:
+            fmt.Fprintf(
+                os.Stderr, "skipping %s, it isn't a file or directory\n",
+                header.Name,
+            )
+        }
+    }
+    if !found {
+        return errors.New("nothing to copy")
+    }
+    return nil
+}
+
+// copyToPod copies localPath to remotePath in the pod on nodeName.
+func (sv *dshCmd) copyToPod(
+    kcontext string, namespace string, ds string, nodeName string,
+    container string, localPath string, remotePath string,
+) error {
+    if nodeName == "" {
+        return errors.New("-N is required when copying to a pod")
+    }
+    if _, err := os.Lstat(localPath); err != nil {
+        return err
+    }
+
+    clientset, config, err := getClientSet(kcontext)
+    if err != nil {
+        return err
+    }
+    err = preflight(clientset, namespace, permListPods, permExec)
+    if err != nil {
+        return err
+    }
+
+    pods, err := getPodsForDaemonSet(clientset, ds, namespace, nodeName)
+    if err != nil {
+        return err
+    }
+
+    if len(pods) == 0 {
+        fmt.Printf("No pods found\n")
+        return nil
+    }
+
+    if len(pods) > 1 {
+        fmt.Printf("More than one pod found, wut?!")
+        return nil
+    }
+
+    var dir, base string
+    if strings.HasSuffix(remotePath, "/") {
+        dir, base = path.Clean(remotePath), filepath.Base(localPath)
+    } else {
+        dir, base = path.Split(path.Clean(remotePath))
+        if dir == "" {
+            dir = "."
+        }
+    }
+
+    reader, writer := io.Pipe()
+    go func() {
+        tw := tar.NewWriter(writer)
+        err := writeTar(tw, localPath, base)
+        if closeErr := tw.Close(); err == nil {
+            err = closeErr
+        }
+        writer.CloseWithError(err)
+    }()
+
+    var stderr bytes.Buffer
+    err = streamExec(
+        clientset, config, namespace, pods[0].Name, container,
+        []string{"tar", "xmf", "-", "-C", dir},
+        remotecommand.StreamOptions{
+            Stdin: reader, Stdout: sv.out, Stderr: &stderr,
+        },
+    )
+    reader.Close()
+    if err != nil && stderr.Len() > 0 {
+        err = fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+    }
+    auditPod("cp", &pods[0], err)
+    return err
+}
+
+// writeTar adds src, and everything under it if it's a directory, to tw as
+// name.
+func writeTar(tw *tar.Writer, src string, name string) error {
+    return filepath.Walk(src, func(file string, info os.FileInfo, err error) error {
+        if err != nil {
+            return err
+        }
+        rel, err := filepath.Rel(src, file)
+        if err != nil {
+            return err
+        }
+
+        var link string
+        if info.Mode()&os.ModeSymlink != 0 {
+            if link, err = os.Readlink(file); err != nil {
+                return err
+            }
+        }
+        header, err := tar.FileInfoHeader(info, link)
+        if err != nil {
+            return err
+        }
+        header.Name = path.Join(name, filepath.ToSlash(rel))
+        if info.IsDir() {
+            header.Name += "/"
+        }
+        if err := tw.WriteHeader(header); err != nil {
+            return err
+        }
+        if !info.Mode().IsRegular() {
+            return nil
+        }
+
+        f, err := os.Open(file)
+        if err != nil {
+            return err
+        }
+        defer f.Close()
+        _, err = io.Copy(tw, f)
+        return err
+    })
+}
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+    "archive/tar"
+    "bytes"
+    "os"
+    "path/filepath"
+    "testing"
+)
+
+// Symlinks that each stay inside dest on their own can still chain into a
+// path that leads out of it, so none may be written.
+func TestUntarSymlinkChainEscape(t *testing.T) {
+    var buf bytes.Buffer
+    tw := tar.NewWriter(&buf)
+    for _, link := range []struct{ name, target string }{
+        {"x/a", "."}, {"x/a/b", ".."}, {"x/a/b/c", ".."},
+    } {
+        err := tw.WriteHeader(&tar.Header{
+            Typeflag: tar.TypeSymlink, Name: link.name,
+            Linkname: link.target, Mode: 0777,
+        })
+        if err != nil {
+            t.Fatal(err)
+        }
+    }
+    content := []byte("escaped\n")
+    err := tw.WriteHeader(&tar.Header{
+        Typeflag: tar.TypeReg, Name: "x/a/b/c/escaped.txt", Mode: 0644,
+        Size: int64(len(content)),
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, err := tw.Write(content); err != nil {
+        t.Fatal(err)
+    }
+    if err := tw.Close(); err != nil {
+        t.Fatal(err)
+    }
+
+    root := t.TempDir()
+    dest := filepath.Join(root, "one", "two", "dest")
+    if err := os.MkdirAll(dest, 0755); err != nil {
+        t.Fatal(err)
+    }
+    if err := untar(&buf, "x", dest); err != nil {
+        t.Fatal(err)
+    }
+
+    err = filepath.Walk(root, func(file string, info os.FileInfo, err error) error {
+        if err != nil {
+            return err
+        }
+        if info.Mode()&os.ModeSymlink != 0 {
+            t.Errorf("symlink %s was written", file)
+        }
+        if info.Name() == "escaped.txt" {
+            rel, _ := filepath.Rel(dest, file)
+            if !filepath.IsLocal(rel) {
+                t.Errorf("%s was written outside of %s", file, dest)
+            }
+        }
+        return nil
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+}
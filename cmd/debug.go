@@ -0,0 +1,252 @@
+package cmd
+
+import (
+    "context"
+    "fmt"
+    "github.com/spf13/cobra"
+    "io"
+    "os"
+    "time"
+
+    v1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    utilrand "k8s.io/apimachinery/pkg/util/rand"
+    "k8s.io/apimachinery/pkg/util/wait"
+    "k8s.io/client-go/kubernetes"
+)
+
+func newDshDebugCommand(
+    out io.Writer, context *string, namespace *string, nodeName *string,
+    config *dshConfig,
+) *cobra.Command {
+    var image string
+    var target string
+    var name string
+    var timeout time.Duration
+    var record string
+
+    dshDebug := &dshCmd{
+        out:    out,
+        config: config,
+    }
+
+    cmd := &cobra.Command{
+        Use:   "debug <daemonset> [<options>] [-- <command> [args...]]",
+        Short: "debug the pod for <daemonset> with an ephemeral container",
+        Long:
+`Adds an ephemeral container to the pod of the specified daemonset on the
+specified node, and attaches to it. The container shares the process
+namespace of the --target container, so you can get a shell next to a daemon
+whose image doesn't have one. For example:
+
+kubectl d debug my-daemonset -N my-node --image=busybox --target=agent
+
+Ephemeral containers can't be removed, so the container stays in the pod,
+exited, until the pod is deleted.`,
+        Annotations: map[string]string{daemonSetArgAnnotation: "true"},
+        Args: cobra.MatchAll(cobra.MinimumNArgs(1)),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            var command []string
+            if cmd.ArgsLenAtDash() != -1 {
+                command = args[cmd.ArgsLenAtDash():]
+            }
+            return dshDebug.debugPod(
+                *context, *namespace, args[0], *nodeName, image, target, name,
+                command, timeout, record,
+            )
+        },
+    }
+
+    cmd.Flags().StringVar(
+        &image, "image", "busybox", "The image for the debug container",
+    )
+    cmd.Flags().StringVar(
+        &target, "target", "",
+        "The container whose processes to share (default: the first one)",
+    )
+    cmd.Flags().StringVar(
+        &name, "name", "", "The name of the debug container (default: random)",
+    )
+    cmd.Flags().DurationVar(
+        &timeout, "timeout", 2*time.Minute,
+        "How long to wait for the debug container to start",
+    )
+    addRecordFlag(cmd, &record)
+    return cmd
+}
+
+func (sv *dshCmd) debugPod(
+    kcontext string, namespace string, ds string, nodeName string,
+    image string, target string, name string, command []string,
+    timeout time.Duration, record string,
+) error {
+    if nodeName == "" {
+        return fmt.Errorf("-N is required")
+    }
+
+    clientset, config, err := getClientSet(kcontext)
+    if err != nil {
+        return err
+    }
+    err = preflight(
+        clientset, namespace, permListPods, permUpdateEphemeral, permAttach,
+    )
+    if err != nil {
+        return err
+    }
+
+    pods, err := getPodsForDaemonSet(clientset, ds, namespace, nodeName)
+    if err != nil {
+        return err
+    }
+
+    if len(pods) == 0 {
+        fmt.Printf("No pods found\n")
+        return nil
+    }
+
+    if len(pods) > 1 {
+        fmt.Printf("More than one pod found, wut?!")
+        return nil
+    }
+
+    pod := &pods[0]
+    if target == "" {
+        target = pod.Spec.Containers[0].Name
+    }
+    if name == "" {
+        name = "debugger-" + utilrand.String(5)
+    }
+
+    pod, err = addDebugContainer(clientset, pod, v1.EphemeralContainer{
+        EphemeralContainerCommon: v1.EphemeralContainerCommon{
+            Name:                     name,
+            Image:                    image,
+            Command:                  command,
+            Stdin:                    true,
+            TTY:                      true,
+            TerminationMessagePolicy: v1.TerminationMessageReadFile,
+        },
+        TargetContainerName: target,
+    })
+    if err != nil {
+        return err
+    }
+
+    fmt.Fprintf(
+        sv.out, "Waiting for container %s in pod %s to start...\n",
+        name, pod.Name,
+    )
+    err = waitForContainer(context.TODO(), clientset, pod, name, timeout)
+    if err != nil {
+        return err
+    }
+
+    streamOptions, restore, err := ttyStreamOptions()
+    if err != nil {
+        return err
+    }
+    defer restore()
+
+    stopRecording, err := startRecording(
+        &sv.config.Record, kcontext, record, pod, name, command, &streamOptions,
+    )
+    if err != nil {
+        return err
+    }
+    defer stopRecording()
+
+    fmt.Fprintf(
+        os.Stderr, "If you don't see a command prompt, try pressing enter.\r\n",
+    )
+    err = streamAttach(
+        context.TODO(), clientset, config, namespace, pod.Name, name,
+        streamOptions,
+    )
+    auditPod("debug", pod, err)
+    return err
+}
+
+// addDebugContainer adds container to the ephemeral containers of pod.
+func addDebugContainer(
+    clientset *kubernetes.Clientset, pod *v1.Pod,
+    container v1.EphemeralContainer,
+) (*v1.Pod, error) {
+    for _, ec := range pod.Spec.EphemeralContainers {
+        if ec.Name == container.Name {
+            return nil, fmt.Errorf(
+                "pod %s already has a container named %s",
+                pod.Name, container.Name,
+            )
+        }
+    }
+
+    pod = pod.DeepCopy()
+    pod.Spec.EphemeralContainers = append(
+        pod.Spec.EphemeralContainers, container,
+    )
+    pod, err := clientset.CoreV1().Pods(pod.Namespace).UpdateEphemeralContainers(
+        context.TODO(), pod.Name, pod, metav1.UpdateOptions{},
+    )
+    if err != nil {
+        return nil, fmt.Errorf("adding debug container: %w", err)
+    }
+    return pod, nil
+}
+
+// waitForContainer waits for the container, or ephemeral container, name in
+// pod to be running, and gives up early if it can't be.
+func waitForContainer(
+    ctx context.Context, clientset *kubernetes.Clientset, pod *v1.Pod,
+    name string, timeout time.Duration,
+) error {
+    var lastWaiting string
+    err := wait.PollUntilContextTimeout(
+        ctx, pollInterval, timeout, true,
+        func(ctx context.Context) (bool, error) {
+            pod, err := clientset.CoreV1().Pods(pod.Namespace).Get(
+                ctx, pod.Name, metav1.GetOptions{},
+            )
+            if err != nil {
+                return false, err
+            }
+            statuses := append(
+                pod.Status.ContainerStatuses,
+                pod.Status.EphemeralContainerStatuses...,
+            )
+            for _, status := range statuses {
+                if status.Name != name {
+                    continue
+                }
+                state := status.State
+                switch {
+                case state.Running != nil:
+                    return true, nil
+                case state.Terminated != nil:
+                    return false, fmt.Errorf(
+                        "container %s exited: %s %s", name,
+                        state.Terminated.Reason, state.Terminated.Message,
+                    )
+                case state.Waiting != nil:
+                    lastWaiting = state.Waiting.Reason
+                    switch state.Waiting.Reason {
+                    case "ErrImagePull", "ImagePullBackOff",
+                            "InvalidImageName", "CreateContainerError":
+                        return false, fmt.Errorf(
+                            "container %s can't start: %s %s", name,
+                            state.Waiting.Reason, state.Waiting.Message,
+                        )
+                    }
+                }
+            }
+            return false, nil
+        },
+    )
+    if wait.Interrupted(err) {
+        return fmt.Errorf(
+            "container %s not running after %s (%s)", name, timeout,
+            orNone(lastWaiting),
+        )
+    }
+    return err
+}
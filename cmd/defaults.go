@@ -0,0 +1,166 @@
+package cmd
+
+import (
+    "github.com/spf13/cobra"
+    "github.com/spf13/pflag"
+    "strings"
+)
+
+// The annotation on commands that take a daemonset as their first argument,
+// so aliases and default containers apply to it. With the value "copy", any
+// argument like <daemonset>:<path> is one, as in cp.
+const daemonSetArgAnnotation = "kubectl-daemons/daemonset-arg"
+
+// expandCommandAlias replaces the subcommand in args with what it's an alias
+// for in aliases, if it is one. Our own commands always win.
+func expandCommandAlias(
+    root *cobra.Command, args []string, aliases map[string]string,
+) []string {
+    if len(aliases) == 0 {
+        return args
+    }
+    flags := root.PersistentFlags()
+    for i := 0; i < len(args); i++ {
+        arg := args[i]
+        if arg == "--" {
+            return args
+        }
+        if strings.HasPrefix(arg, "-") {
+            if !strings.Contains(arg, "=") && flagTakesValue(flags, arg) {
+                i++
+            }
+            continue
+        }
+        expansion, ok := aliases[arg]
+        if !ok {
+            return args
+        }
+        if found, _, err := root.Find([]string{arg}); err == nil &&
+            found != root {
+            return args
+        }
+        expanded := append([]string{}, args[:i]...)
+        expanded = append(expanded, strings.Fields(expansion)...)
+        return append(expanded, args[i+1:]...)
+    }
+    return args
+}
+
+// flagTakesValue says whether arg, one of flags, is followed by its value,
+// as in -n kube-system, rather than having it attached, or being a switch.
+func flagTakesValue(flags *pflag.FlagSet, arg string) bool {
+    var flag *pflag.Flag
+    if strings.HasPrefix(arg, "--") {
+        flag = flags.Lookup(arg[2:])
+    } else if len(arg) == 2 {
+        flag = flags.ShorthandLookup(arg[1:])
+    }
+    return flag != nil && flag.Value.Type() != "bool"
+}
+
+// applyDefaults fills in what the config file says to, for anything not
+// given on the command line: the namespace for the context, the daemonset
+// aliases stand for, and the daemonset's container.
+func (c *dshConfig) applyDefaults(
+    cmd *cobra.Command, args []string, kcontext string, namespace *string,
+) error {
+    namespaceGiven := cmd.Flags().Changed("namespace")
+    if !namespaceGiven && len(c.Defaults.Namespaces) > 0 {
+        contextName, _, err := getContextInfo(kcontext)
+        if err != nil {
+            return err
+        }
+        if ns, ok := c.Defaults.Namespaces[contextName]; ok {
+            *namespace = ns
+        }
+    }
+
+    kind, ok := cmd.Annotations[daemonSetArgAnnotation]
+    if !ok {
+        return nil
+    }
+    // anything after -- is a command, not a daemonset
+    if dash := cmd.ArgsLenAtDash(); dash >= 0 {
+        args = args[:dash]
+    }
+    ds := ""
+    for i := range args {
+        if kind != "copy" && i > 0 {
+            break
+        }
+        arg, name, ns := c.resolveDaemonSetArg(args[i], kind)
+        if name == "" {
+            continue
+        }
+        args[i] = arg
+        ds = name
+        if ns != "" && !namespaceGiven {
+            *namespace = ns
+        }
+    }
+
+    flag := cmd.Flags().Lookup("container")
+    if ds == "" || flag == nil || flag.Changed {
+        return nil
+    }
+    container, ok := c.Defaults.Containers[*namespace+"/"+ds]
+    if !ok {
+        container, ok = c.Defaults.Containers[ds]
+    }
+    if !ok {
+        return nil
+    }
+    return flag.Value.Set(container)
+}
+
+// resolveDaemonSetArg finds the daemonset in arg, which for kind copy is
+// <daemonset>:<path>, and may be ds/<daemonset> otherwise. If it's an alias,
+// arg is rewritten with the daemonset it stands for, and the namespace it's
+// in, if the alias says.
+func (c *dshConfig) resolveDaemonSetArg(
+    arg string, kind string,
+) (string, string, string) {
+    prefix, name, suffix := "", arg, ""
+    if kind == "copy" {
+        ds, _, remote := parseCopyArg(arg)
+        if !remote {
+            return arg, "", ""
+        }
+        name, suffix = ds, arg[len(ds):]
+    } else if ds, ok := parseDaemonSetArg(arg); ok {
+        prefix, name = arg[:len(arg)-len(ds)], ds
+    }
+
+    target, ok := c.Aliases.DaemonSets[name]
+    if !ok {
+        return arg, name, ""
+    }
+    ns, ds, found := strings.Cut(target, "/")
+    if !found {
+        ns, ds = "", target
+    }
+    return prefix + ds + suffix, ds, ns
+}
+
+// argDaemonSet is the daemonset in cmd's args, if it takes one and it's
+// there.
+func argDaemonSet(cmd *cobra.Command, args []string) string {
+    if dash := cmd.ArgsLenAtDash(); dash >= 0 {
+        args = args[:dash]
+    }
+    ds := ""
+    switch cmd.Annotations[daemonSetArgAnnotation] {
+    case "":
+    case "copy":
+        for _, arg := range args {
+            if name, _, remote := parseCopyArg(arg); remote {
+                ds = name
+            }
+        }
+    default:
+        if len(args) > 0 {
+            ds, _ = parseDaemonSetArg(args[0])
+        }
+    }
+    return ds
+}
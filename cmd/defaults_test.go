@@ -0,0 +1,220 @@
+package cmd
+
+import (
+    "io"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+
+    "github.com/spf13/cobra"
+)
+
+// testKubeconfig points KUBECONFIG at a kubeconfig with the contexts
+// "prod" and "dev", and "prod" current.
+func testKubeconfig(t *testing.T) {
+    kubeconfig := filepath.Join(t.TempDir(), "config")
+    err := os.WriteFile(kubeconfig, []byte(`apiVersion: v1
+kind: Config
+current-context: prod
+clusters:
+- name: prod
+  cluster: {server: "https://prod.example.com"}
+- name: dev
+  cluster: {server: "https://dev.example.com"}
+users:
+- name: admin
+  user: {token: secret}
+contexts:
+- name: prod
+  context: {cluster: prod, user: admin}
+- name: dev
+  context: {cluster: dev, user: admin}
+`), 0600)
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Setenv("KUBECONFIG", kubeconfig)
+}
+
+// defaultsResult is what a command ran with after applyDefaults.
+type defaultsResult struct {
+    args      []string
+    namespace string
+    container string
+}
+
+// testDefaultsCommand is a root command with -n and --context, that applies
+// config's defaults, and subcommands like ours that record what they ran
+// with in result.
+func testDefaultsCommand(
+    config *dshConfig, result *defaultsResult,
+) *cobra.Command {
+    var kcontext, namespace string
+    root := &cobra.Command{
+        Use:           "kubectl-d",
+        SilenceErrors: true,
+        SilenceUsage:  true,
+        PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+            return config.applyDefaults(cmd, args, kcontext, &namespace)
+        },
+    }
+    root.SetOut(io.Discard)
+    root.PersistentFlags().StringVar(&kcontext, "context", "", "")
+    root.PersistentFlags().StringVarP(&namespace, "namespace", "n", "", "")
+    root.PersistentFlags().StringP("node", "N", "", "")
+
+    for _, sub := range []struct {
+        name string
+        kind string
+    }{
+        {"exec", "true"}, {"cp", "copy"}, {"list", ""},
+    } {
+        var container string
+        cmd := &cobra.Command{
+            Use: sub.name,
+            RunE: func(cmd *cobra.Command, args []string) error {
+                *result = defaultsResult{args, namespace, container}
+                return nil
+            },
+        }
+        if sub.kind != "" {
+            cmd.Annotations = map[string]string{
+                daemonSetArgAnnotation: sub.kind,
+            }
+            cmd.Flags().StringVarP(&container, "container", "c", "", "")
+        }
+        cmd.Flags().Bool("evict", false, "")
+        root.AddCommand(cmd)
+    }
+    return root
+}
+
+func TestExpandCommandAlias(t *testing.T) {
+    aliases := map[string]string{
+        "bounce": "exec --evict",
+        "exec":   "list",
+        "shell":  "exec -c main",
+    }
+    root := testDefaultsCommand(&dshConfig{}, &defaultsResult{})
+
+    tests := []struct {
+        args string
+        want string
+    }{
+        {"bounce agent", "exec --evict agent"},
+        {"-n infra bounce agent -N n1", "-n infra exec --evict agent -N n1"},
+        {"--context=dev bounce agent", "--context=dev exec --evict agent"},
+        {"-N n1 shell agent", "-N n1 exec -c main agent"},
+        // our own commands win
+        {"exec agent", "exec agent"},
+        // only the subcommand is expanded
+        {"-n bounce list", "-n bounce list"},
+        {"list bounce", "list bounce"},
+        {"-- bounce", "-- bounce"},
+        {"unknown bounce", "unknown bounce"},
+        {"", ""},
+    }
+    for _, tt := range tests {
+        got := expandCommandAlias(root, strings.Fields(tt.args), aliases)
+        if strings.Join(got, " ") != tt.want {
+            t.Errorf("%q expanded to %q, want %q", tt.args, got, tt.want)
+        }
+    }
+
+    args := []string{"bounce", "agent"}
+    if got := expandCommandAlias(root, args, nil); &got[0] != &args[0] {
+        t.Errorf("without aliases, got %q, want the args as they were", got)
+    }
+}
+
+func TestApplyDefaults(t *testing.T) {
+    testKubeconfig(t)
+    config := &dshConfig{
+        Defaults: defaultsConfig{
+            Namespaces: map[string]string{"prod": "infra", "dev": "sandbox"},
+            Containers: map[string]string{
+                "agent":            "main",
+                "monitoring/agent": "exporter",
+            },
+        },
+        Aliases: aliasesConfig{DaemonSets: map[string]string{
+            "ag":  "agent",
+            "mon": "monitoring/agent",
+        }},
+    }
+
+    tests := []struct {
+        args string
+        want defaultsResult
+    }{
+        {
+            "exec agent",
+            defaultsResult{[]string{"agent"}, "infra", "main"},
+        },
+        {
+            "--context dev exec agent",
+            defaultsResult{[]string{"agent"}, "sandbox", "main"},
+        },
+        {
+            "exec -n other agent",
+            defaultsResult{[]string{"agent"}, "other", "main"},
+        },
+        {
+            "exec agent -c sidecar",
+            defaultsResult{[]string{"agent"}, "infra", "sidecar"},
+        },
+        {
+            "exec ag -- ag",
+            defaultsResult{[]string{"agent", "ag"}, "infra", "main"},
+        },
+        {
+            "exec ds/ag",
+            defaultsResult{[]string{"ds/agent"}, "infra", "main"},
+        },
+        {
+            "exec mon",
+            defaultsResult{[]string{"agent"}, "monitoring", "exporter"},
+        },
+        // -n wins over the alias' namespace, and the container follows it
+        {
+            "exec mon -n infra",
+            defaultsResult{[]string{"agent"}, "infra", "main"},
+        },
+        {
+            "exec other",
+            defaultsResult{[]string{"other"}, "infra", ""},
+        },
+        {
+            "cp mon:/etc/agent.yaml agent.yaml",
+            defaultsResult{
+                []string{"agent:/etc/agent.yaml", "agent.yaml"},
+                "monitoring", "exporter",
+            },
+        },
+        {
+            "cp ./mon:x ag:/tmp/",
+            defaultsResult{[]string{"./mon:x", "agent:/tmp/"}, "infra", "main"},
+        },
+        // commands without a daemonset only get the namespace
+        {
+            "list ag",
+            defaultsResult{[]string{"ag"}, "infra", ""},
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.args, func(t *testing.T) {
+            var got defaultsResult
+            root := testDefaultsCommand(config, &got)
+            root.SetArgs(strings.Fields(tt.args))
+            if err := root.Execute(); err != nil {
+                t.Fatal(err)
+            }
+            if strings.Join(got.args, " ") != strings.Join(tt.want.args, " ") ||
+                got.namespace != tt.want.namespace ||
+                got.container != tt.want.container {
+                t.Errorf("got %+v, want %+v", got, tt.want)
+            }
+        })
+    }
+}
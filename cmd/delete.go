@@ -2,44 +2,158 @@ package cmd
 
 import (
     "context"
+    "errors"
     "fmt"
     "github.com/spf13/cobra"
     "io"
-    
+    "os"
+    "sort"
+    "time"
+
+    v1 "k8s.io/api/core/v1"
+    policyv1 "k8s.io/api/policy/v1"
+    apierrors "k8s.io/apimachinery/pkg/api/errors"
     metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/cli-runtime/pkg/printers"
+    "k8s.io/client-go/kubernetes"
 )
 
+// deleteOptions are the flags of delete
+type deleteOptions struct {
+    dryRun      string
+    yes         bool
+    maxPods     int
+    gracePeriod int
+    force       bool
+    wait        bool
+    evict       bool
+    timeout     time.Duration
+}
+
 func newDshDeleteCommand(
     out io.Writer, context *string, namespace *string, nodeName *string,
+    config *dshConfig,
 ) *cobra.Command {
+    var opts deleteOptions
+
     dshDelete := &dshCmd{
-        out: out,
+        out:    out,
+        config: config,
     }
 
     cmd := &cobra.Command{
-        Use:   "delete <daemonset> [<options>]",
+        Use:   "delete [<daemonset>] [<options>]",
         Short: "delete pods for <daemonset>",
         Long:
 `Deletes matching pods from the daemonset and/or node. If only a daemonset is
 specified, all pods for that daemonset will be deleted. If only a node is
 specified, all pods belonging to daemonsets on that node will be deleted. If
-both are specified, the pod in that daemonset on that node will be deleted.`,
-        Args: cobra.MatchAll(cobra.ExactArgs(1)),
+both are specified, the pod in that daemonset on that node will be deleted.
+
+Deleting more than one pod (or delete.confirmAbove in the config file) asks
+for confirmation first, unless you pass --yes. Deleting more than --max-pods
+pods (by default delete.maxPods in the config file, or 50) is refused, and
+--yes doesn't change that. Pass --max-pods=-1 for no limit.
+
+With --evict, pods are evicted rather than deleted, so PodDisruptionBudgets
+are respected. With --wait, we wait for each pod to be gone and for the
+daemonset to have a ready replacement on its node.`,
+        Annotations: map[string]string{daemonSetArgAnnotation: "true"},
+        Args: cobra.MatchAll(cobra.MaximumNArgs(1)),
         RunE: func(cmd *cobra.Command, args []string) error {
-            return dshDelete.deletePods(*context, *namespace, args[0], *nodeName)
+            ds := ""
+            if len(args) == 1 {
+                ds = args[0]
+            }
+            if ds == "" && *nodeName == "" {
+                return errors.New(
+                    "a daemonset, a node (-N), or both are required",
+                )
+            }
+            switch opts.dryRun {
+            case "none", "client", "server":
+            default:
+                return fmt.Errorf(
+                    "--dry-run must be none, client or server, not %q",
+                    opts.dryRun,
+                )
+            }
+            // like kubectl, only --force deletes immediately
+            switch {
+            case opts.force && opts.gracePeriod > 0:
+                return errors.New(
+                    "--force can't be used with a --grace-period above 0",
+                )
+            case opts.force:
+                opts.gracePeriod = 0
+            case opts.gracePeriod == 0:
+                opts.gracePeriod = 1
+            }
+            return dshDelete.deletePods(
+                *context, *namespace, ds, *nodeName, opts,
+            )
         },
     }
 
+    cmd.Flags().StringVar(
+        &opts.dryRun, "dry-run", "none",
+        "Only show what would be deleted: none, client, or server, which " +
+        "has the API server check the delete without doing it",
+    )
+    cmd.Flags().Lookup("dry-run").NoOptDefVal = "client"
+    cmd.Flags().BoolVarP(
+        &opts.yes, "yes", "y", false, "Don't ask for confirmation",
+    )
+    cmd.Flags().IntVar(
+        &opts.maxPods, "max-pods", 0,
+        "Refuse to delete more than this many pods, even with --yes, -1 " +
+        "for no limit (default delete.maxPods from the config file, or 50)",
+    )
+    cmd.Flags().IntVar(
+        &opts.gracePeriod, "grace-period", -1,
+        "Seconds the pods get to shut down, -1 for their own default, and " +
+        "0 is taken as 1 unless you also give --force",
+    )
+    cmd.Flags().BoolVar(
+        &opts.force, "force", false,
+        "Delete the pods right away, without waiting for the kubelet to " +
+        "confirm they're gone",
+    )
+    cmd.Flags().BoolVar(
+        &opts.wait, "wait", false,
+        "Wait for the pods to be gone and replaced by ready ones",
+    )
+    cmd.Flags().BoolVar(
+        &opts.evict, "evict", false,
+        "Evict the pods, respecting PodDisruptionBudgets, instead of deleting",
+    )
+    cmd.Flags().DurationVar(
+        &opts.timeout, "timeout", 5*time.Minute,
+        "How long to wait for each pod with --wait",
+    )
+    cmd.MarkFlagsMutuallyExclusive("force", "evict")
     return cmd
 }
 
 func (sv *dshCmd) deletePods(
     ccontext string, namespace string, ds string, nodeName string,
+    opts deleteOptions,
 ) error {
     clientset, _, err := getClientSet(ccontext)
     if err != nil {
         return err
     }
+    perms := []permission{permListPods}
+    if opts.dryRun != "client" {
+        if opts.evict {
+            perms = append(perms, permEvict)
+        } else {
+            perms = append(perms, permDeletePods)
+        }
+    }
+    if err := preflight(clientset, namespace, perms...); err != nil {
+        return err
+    }
 
     pods, err := getPodsForDaemonSet(clientset, ds, namespace, nodeName)
     if err != nil {
@@ -51,15 +165,156 @@ func (sv *dshCmd) deletePods(
         return nil
     }
 
-    for _, pod := range pods {
-        err := clientset.CoreV1().Pods(namespace).Delete(
-            context.TODO(), pod.Name, metav1.DeleteOptions{},
+    maxPods := opts.maxPods
+    if maxPods == 0 {
+        maxPods = sv.config.Delete.maxPods()
+    }
+    if maxPods > 0 && len(pods) > maxPods {
+        return fmt.Errorf(
+            "refusing to delete %d pods, more than the limit of %d, which " +
+            "--max-pods or delete.maxPods in the config file can change",
+            len(pods), maxPods,
+        )
+    }
+
+    if opts.dryRun == "none" && !opts.yes {
+        if len(pods) > sv.config.Delete.confirmAbove() {
+            ok, err := sv.confirmDelete(pods)
+            if err != nil {
+                return err
+            }
+            if !ok {
+                return errors.New("not deleting anything")
+            }
+        }
+    }
+
+    deleteOptions := metav1.DeleteOptions{}
+    if opts.gracePeriod >= 0 {
+        gracePeriod := int64(opts.gracePeriod)
+        deleteOptions.GracePeriodSeconds = &gracePeriod
+    }
+    if opts.gracePeriod == 0 {
+        fmt.Fprintf(
+            os.Stderr,
+            "Warning: Immediate deletion does not wait for confirmation " +
+            "that the running resource has been terminated. The resource " +
+            "may continue to run on the cluster indefinitely.\n",
         )
+    }
+    command, verb, action := "delete", "deleted", "deleting"
+    if opts.evict {
+        command, verb, action = "evict", "evicted", "evicting"
+    }
+    suffix := ""
+    switch opts.dryRun {
+    case "client":
+        suffix = " (dry run)"
+    case "server":
+        deleteOptions.DryRun = []string{metav1.DryRunAll}
+        suffix = " (server dry run)"
+    }
+
+    var deleted []*v1.Pod
+    for i := range pods {
+        pod := &pods[i]
+        if opts.dryRun != "client" {
+            var err error
+            if opts.evict {
+                err = evictPod(clientset, pod, deleteOptions)
+            } else {
+                err = clientset.CoreV1().Pods(namespace).Delete(
+                    context.TODO(), pod.Name, deleteOptions,
+                )
+            }
+            if opts.dryRun == "none" {
+                auditPod(command, pod, err)
+            }
+            if err != nil {
+                fmt.Printf("Error %s pod %s: %v\n", action, pod.Name, err)
+                continue
+            }
+        }
+        fmt.Printf("pod \"%s\" %s%s\n", pod.Name, verb, suffix)
+        deleted = append(deleted, pod)
+    }
+
+    if !opts.wait || opts.dryRun != "none" {
+        return nil
+    }
+    failed := 0
+    for _, pod := range deleted {
+        err := waitForPodGone(clientset, pod, opts.timeout)
+        var replacement *v1.Pod
+        if err == nil {
+            replacement, err = waitForReplacementPod(
+                clientset, pod, opts.timeout,
+            )
+        }
         if err != nil {
-            fmt.Printf("Error deleting pod %s: %v\n", pod.Name, err)
-        } else {
-            fmt.Printf("pod \"%s\" deleted\n", pod.Name)
+            fmt.Printf("Error waiting for pod %s: %v\n", pod.Name, err)
+            failed++
+            continue
         }
+        fmt.Printf(
+            "pod \"%s\" on node %s replaced by \"%s\", ready at %s\n",
+            pod.Name, pod.Spec.NodeName, replacement.Name,
+            podReadyTime(replacement).Format(time.RFC1123),
+        )
+    }
+    if failed > 0 {
+        return fmt.Errorf(
+            "%d of %d pods weren't replaced in time", failed, len(deleted),
+        )
     }
     return nil
 }
+
+// evictPod asks the API server to evict pod, which it only does if no
+// PodDisruptionBudget would be violated.
+func evictPod(
+    clientset *kubernetes.Clientset, pod *v1.Pod,
+    deleteOptions metav1.DeleteOptions,
+) error {
+    err := clientset.PolicyV1().Evictions(pod.Namespace).Evict(
+        context.TODO(), &policyv1.Eviction{
+            ObjectMeta: metav1.ObjectMeta{
+                Name: pod.Name, Namespace: pod.Namespace,
+            },
+            DeleteOptions: &deleteOptions,
+        },
+    )
+    if apierrors.IsTooManyRequests(err) {
+        return fmt.Errorf(
+            "it would violate a disruption budget, try again later: %w", err,
+        )
+    }
+    return err
+}
+
+// confirmDelete shows the pods we're about to delete, and asks if that's
+// really what the user wants.
+func (sv *dshCmd) confirmDelete(pods []v1.Pod) (bool, error) {
+    sort.Slice(pods, func(i, j int) bool {
+        return pods[i].Spec.NodeName < pods[j].Spec.NodeName
+    })
+    w := printers.GetNewTabWriter(sv.out)
+    fmt.Fprintln(w, "NODE\tPOD")
+    for _, pod := range pods {
+        fmt.Fprintf(w, "%s\t%s\n", pod.Spec.NodeName, pod.Name)
+    }
+    if err := w.Flush(); err != nil {
+        return false, err
+    }
+
+    ok, err := confirm(
+        sv.out, fmt.Sprintf("Delete these %d pods?", len(pods)),
+    )
+    if err == nil && !ok && !isTerminal() {
+        err = fmt.Errorf(
+            "refusing to delete %d pods without --yes, since there's no " +
+            "terminal to ask for confirmation on", len(pods),
+        )
+    }
+    return ok, err
+}
@@ -2,20 +2,35 @@ package cmd
 
 import (
     "context"
+    "errors"
     "fmt"
     "github.com/spf13/cobra"
     "io"
-    "time"
+    "text/tabwriter"
 
-    "golang.org/x/text/cases"
-    "golang.org/x/text/language"
     v1 "k8s.io/api/core/v1"
     metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/fields"
+    "k8s.io/apimachinery/pkg/types"
+    "k8s.io/client-go/kubernetes"
+    "k8s.io/client-go/rest"
+    "k8s.io/kubectl/pkg/describe"
 )
 
+// describeOptions are the flags that change what describe shows
+type describeOptions struct {
+    showEvents  bool
+    resolveEnv  bool
+    showSecrets bool
+    output      string
+}
+
 func newDshDescribeCommand(
     out io.Writer, context *string, namespace *string, nodeName *string,
 ) *cobra.Command {
+    var opts describeOptions
+    var daemonSet bool
+
     dshDescribe := &dshCmd{
         out: out,
     }
@@ -27,24 +42,85 @@ func newDshDescribeCommand(
 `Describe pods matching a given daemonset and node. Any combination is allowed.
 If only a node is specified all pods owned by a daemonset on that node will be
 described. If only a daemonset is specified, a all pods in that daemonset will
-be described.`,
+be described.
+
+To describe the daemonset itself, use ds/<daemonset> or --daemonset. If a node
+is also given, the description of the daemonset's pod on that node and the
+node's conditions are added to the report.
+
+With -o json or -o yaml, each pod is printed as a single document that holds
+the pod, the events of the pod, its node and its daemonset (unless you pass
+--show-events=false), the node's conditions, and a summary of the daemonset.
+
+With --resolve-env, the environment of each container is shown the way the
+container sees it: values from ConfigMaps, the downward API and resource
+fields are filled in, and ConfigMaps and Secrets mounted as volumes are listed
+with their resourceVersion. Values from Secrets are redacted, without reading
+them, unless you also pass --show-secrets, so all of a Secret in envFrom
+shows as one <prefix>* variable.`,
+        Annotations: map[string]string{daemonSetArgAnnotation: "true"},
         Args: cobra.MatchAll(cobra.MaximumNArgs(1)),
         RunE: func(cmd *cobra.Command, args []string) error {
             ds := ""
             if len(args) == 1 {
                 ds = args[0]
             }
-            return dshDescribe.describePods(*context, *namespace, ds, *nodeName)
+            if opts.showSecrets {
+                opts.resolveEnv = true
+            }
+            if name, ok := parseDaemonSetArg(ds); ok || daemonSet {
+                if name == "" {
+                    return errors.New("you must specify a daemonset")
+                }
+                if opts.output != "" {
+                    return errors.New(
+                        "--output is only supported when describing pods",
+                    )
+                }
+                return dshDescribe.describeDaemonSet(
+                    *context, *namespace, name, *nodeName, opts,
+                )
+            }
+            return dshDescribe.describePods(
+                *context, *namespace, ds, *nodeName, opts,
+            )
         },
     }
 
+    cmd.Flags().BoolVar(
+        &opts.showEvents, "show-events", true,
+        "If true, display events related to the described pods",
+    )
+    cmd.Flags().BoolVar(
+        &daemonSet, "daemonset", false,
+        "Describe the daemonset instead of its pods",
+    )
+    cmd.Flags().StringVarP(
+        &opts.output, "output", "o", "", "Output format. One of json, yaml.",
+    )
+    cmd.Flags().BoolVar(
+        &opts.resolveEnv, "resolve-env", false,
+        "Show the environment of each container as the container sees it",
+    )
+    cmd.Flags().BoolVar(
+        &opts.showSecrets, "show-secrets", false,
+        "With --resolve-env, show values from Secrets instead of redacting them",
+    )
+
     return cmd
 }
 
 func (sv *dshCmd) describePods(
     ccontext string, namespace string, ds string, nodeName string,
+    opts describeOptions,
 ) error {
-    clientset, _, err := getClientSet(ccontext)
+    if opts.output != "" && opts.output != "json" && opts.output != "yaml" {
+        return fmt.Errorf(
+            "unknown output format %q, must be json or yaml", opts.output,
+        )
+    }
+
+    clientset, config, err := getClientSet(ccontext)
     if err != nil {
         return err
     }
@@ -59,228 +135,171 @@ func (sv *dshCmd) describePods(
         return nil
     }
 
-    for _, pod := range pods {
-        podinfo, err := clientset.CoreV1().Pods(namespace).Get(
-            context.TODO(), pod.Name, metav1.GetOptions{},
-        )
-        if err != nil {
-            return err
+    if opts.output != "" {
+        for i := range pods {
+            report, err := buildPodReport(
+                clientset, config, namespace, &pods[i], opts,
+            )
+            if err != nil {
+                return err
+            }
+            if err := printReport(sv.out, opts.output, report); err != nil {
+                return err
+            }
         }
+        return nil
+    }
 
-        events, err := clientset.CoreV1().Events(namespace).List(
-            context.TODO(),
-            metav1.ListOptions{
-                FieldSelector: fmt.Sprintf("involvedObject.name=%s", pod.Name),
-            },
-        )
+    for i := range pods {
+        if i > 0 {
+            fmt.Fprintln(sv.out)
+        }
+        err := sv.describePod(clientset, config, namespace, &pods[i], opts)
         if err != nil {
             return err
         }
-
-        dumpPod(podinfo, events)
     }
 
     return nil
 }
 
-/*
- * There has to be some function in the kube libraries
- * I can use to do this... but I have yet to find one, so
- * here we are.
- */
-func dumpPod(pod *v1.Pod, events *v1.EventList) {
-    fmt.Printf("Name:         %s\n", pod.Name)
-    fmt.Printf("Namespace:    %s\n", pod.Namespace)
-    fmt.Printf("Priority:     %d\n", *pod.Spec.Priority)
-    fmt.Printf("Node:         %s/%s\n", pod.Spec.NodeName, pod.Status.HostIP)
-    fmt.Printf("Start Time:   %s\n", pod.Status.StartTime.Format(time.RFC1123))
-
-    fmt.Println("Labels:")
-    for key, value := range pod.Labels {
-        fmt.Printf("              %s: %s\n", key, value)
+func (sv *dshCmd) describePod(
+    clientset *kubernetes.Clientset, config *rest.Config, namespace string,
+    pod *v1.Pod, opts describeOptions,
+) error {
+    // We do the events ourselves so we can sort and de-duplicate them
+    describer := &describe.PodDescriber{Interface: clientset}
+    text, err := describer.Describe(
+        namespace, pod.Name, describe.DescriberSettings{},
+    )
+    if err != nil {
+        return err
     }
-
-    fmt.Println("Annotations:")
-    for key, value := range pod.Annotations {
-        fmt.Printf("              %s: %s\n", key, value)
+    fmt.Fprint(sv.out, text)
+
+    if opts.resolveEnv {
+        resolver := newEnvResolver(clientset, config, pod, opts.showSecrets)
+        envs := resolver.resolveAll()
+        mounted := resolver.mountedConfigs()
+        err := describeTo(sv.out, func(w describe.PrefixWriter) {
+            describeResolvedEnv(envs, mounted, w)
+        })
+        if err != nil {
+            return err
+        }
     }
 
-    fmt.Printf("Status:       %s\n", pod.Status.Phase)
-    fmt.Printf("IP:           %s\n", pod.Status.PodIP)
-
-    fmt.Println("IPs:")
-    for _, podIP := range pod.Status.PodIPs {
-        fmt.Printf("  IP:           %s\n", podIP.IP)
+    if !opts.showEvents {
+        return nil
     }
-
-    if len(pod.OwnerReferences) > 0 {
-        fmt.Printf("Controlled By:  %s/%s\n",
-            pod.OwnerReferences[0].Kind, pod.OwnerReferences[0].Name,
-        )
-    } else {
-        fmt.Println("Controlled By:  <none>")
+    events, err := getEvents(
+        clientset, namespace, "Pod", pod.Name, pod.UID,
+    )
+    if err != nil {
+        return err
     }
+    return describeTo(sv.out, func(w describe.PrefixWriter) {
+        describe.DescribeEvents(events, w)
+    })
+}
 
-    fmt.Printf("Containers:\n")
-    for i, containerStatus := range pod.Status.ContainerStatuses {
-        containerSpec := pod.Spec.Containers[i]
-
-        containerID := containerStatus.ContainerID
-        containerName := containerStatus.Name
-        imageID := containerStatus.ImageID
+// describeTo runs f against a PrefixWriter that aligns columns the same way
+// kubectl's own describers do.
+func describeTo(out io.Writer, f func(describe.PrefixWriter)) error {
+    tw := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+    f(describe.NewPrefixWriter(tw))
+    return tw.Flush()
+}
 
-        fmt.Printf("  %s\n", containerName)
-        fmt.Printf("    Container ID:  %s\n", containerID)
-        fmt.Printf("    Image:         %s\n", containerSpec.Image)
-        fmt.Printf("    Image ID:      %s\n", imageID)
+// getEvents returns the events for the object with the given kind, name and
+// UID, merged by dedupEvents. For cluster-scoped objects, pass an empty
+// namespace.
+func getEvents(
+    clientset *kubernetes.Clientset, namespace string, kind string,
+    name string, uid types.UID,
+) (*v1.EventList, error) {
+    selector := fields.Set{
+        "involvedObject.kind": kind,
+        "involvedObject.name": name,
+        "involvedObject.namespace": namespace,
+    }
+    if uid != "" {
+        selector["involvedObject.uid"] = string(uid)
+    }
+    events, err := clientset.CoreV1().Events(namespace).List(
+        context.TODO(),
+        metav1.ListOptions{
+            FieldSelector: selector.AsSelector().String(),
+        },
+    )
+    if err != nil {
+        return nil, err
+    }
+    events.Items = dedupEvents(events.Items)
+    return events, nil
+}
 
-        for _, port := range containerSpec.Ports {
-            fmt.Printf("      - Port:       %v\n", port.ContainerPort)
-            fmt.Printf("        Host Port:  %d\n", port.HostPort)
-        }
+// dedupEvents merges events that only differ in when and how often they
+// happened, which is common when a daemon crashloops or a probe flaps.
+// Everything ends up with a LastTimestamp, since that's what describe
+// sorts by, and events that were only ever reported with the newer
+// EventTime/Series fields otherwise all sort to the top.
+func dedupEvents(events []v1.Event) []v1.Event {
+    type eventKey struct {
+        eventType string
+        reason    string
+        source    string
+        fieldPath string
+        message   string
+    }
 
-        fmt.Println("    Command:")
-        for _, cmdbit := range containerSpec.Command {
-            fmt.Printf("      %s\n", cmdbit)
+    var merged []v1.Event
+    index := make(map[eventKey]int)
+    for _, event := range events {
+        normalizeEvent(&event)
+        key := eventKey{
+            eventType: event.Type,
+            reason:    event.Reason,
+            source:    event.Source.Component + event.ReportingController,
+            fieldPath: event.InvolvedObject.FieldPath,
+            message:   event.Message,
         }
-
-        state := containerStatus.State
-        fmt.Printf("    State:          ")
-        switch {
-        case state.Waiting != nil:
-            fmt.Printf("Waiting\n")
-        case state.Running != nil:
-            fmt.Printf("Running\n")
-            fmt.Printf(
-                "      Started:      %s\n",
-                state.Running.StartedAt.Format(time.RFC1123),
-            )
-        case state.Terminated != nil:
-            fmt.Printf("Terminated\n")
-            fmt.Printf("      Exit Code:    %d\n", state.Terminated.ExitCode)
-        default:
-            fmt.Printf("Unknown\n")
+        i, ok := index[key]
+        if !ok {
+            index[key] = len(merged)
+            merged = append(merged, event)
+            continue
         }
 
-
-        // transform the bool (true/false) into a string,
-        // so we can capitolize it (True/False) to match kubectl
-        readiness := fmt.Sprintf("%t", containerStatus.Ready)
-        caser := cases.Title(language.English)
-        upperReady := caser.String(readiness)
-        fmt.Printf("    Ready:          %s\n", upperReady)
-
-        restartCount := containerStatus.RestartCount
-        fmt.Printf("    Restart Count:  %d\n", restartCount)
-
-        fmt.Printf("    Environment:\n")
-        for _, envVar := range containerSpec.Env {
-            fmt.Printf("      - %s=%s\n", envVar.Name, envVar.Value)
+        existing := &merged[i]
+        existing.Count += event.Count
+        if event.FirstTimestamp.Before(&existing.FirstTimestamp) {
+            existing.FirstTimestamp = event.FirstTimestamp
         }
-
-        fmt.Printf("    Mounts:\n")
-        for _, mount := range containerSpec.VolumeMounts {
-            fmt.Printf("      %s from %s", mount.MountPath, mount.Name)
-
-            if mount.SubPath != "" {
-                fmt.Printf(" (subpath: %s)", mount.SubPath)
-            }
-
-            if mount.ReadOnly {
-                fmt.Printf(" (ro)")
-            }
-
-            fmt.Println()
+        if existing.LastTimestamp.Before(&event.LastTimestamp) {
+            existing.LastTimestamp = event.LastTimestamp
         }
     }
+    return merged
+}
 
-    fmt.Println("Conditions:")
-    for _, condition := range pod.Status.Conditions {
-        fmt.Printf("  %-20s %v\n", condition.Type, condition.Status)
-    }
-
-    fmt.Println("Volumes:")
-    for _, volume := range pod.Spec.Volumes {
-        fmt.Printf("  %s:\n", volume.Name)
-
-        if volume.Projected != nil {
-            fmt.Printf("    Type:                    Projected\n")
-            for _, source := range volume.Projected.Sources {
-                if source.ServiceAccountToken != nil {
-                    projection := source.ServiceAccountToken
-                    fmt.Printf(
-                        "    TokenExpirationSeconds:  %d\n",
-                        *projection.ExpirationSeconds,
-                    )
-                } else if source.ConfigMap != nil {
-                    projection := source.ConfigMap
-                    fmt.Printf(
-                        "    ConfigMapName:           %s\n",
-                        projection.Name,
-                    )
-                    fmt.Printf(
-                        "    ConfigMapOptional:       %v\n",
-                        projection.Optional,
-                    )
-                } else if source.DownwardAPI != nil {
-                    fmt.Printf(
-                        "    DownwardAPI:             %t\n",
-                        true,
-                    )
-                } else {
-                    fmt.Println("    (Volume source not recognized)")
-                }
-            }
-        } else {
-            fmt.Println("    (Volume source not recognized)")
-        }
+// normalizeEvent fills in the legacy Count/FirstTimestamp/LastTimestamp
+// fields from EventTime and Series where they're missing, and clears the
+// latter so describe prints the merged values.
+func normalizeEvent(event *v1.Event) {
+    if event.FirstTimestamp.IsZero() && !event.EventTime.IsZero() {
+        event.FirstTimestamp = metav1.NewTime(event.EventTime.Time)
     }
-
-    fmt.Printf(
-        "QoS Class:                   %s\n",
-        string(pod.Status.QOSClass),
-    )
-
-    fmt.Println("Node-Selectors:")
-    for key, val := range pod.Spec.NodeSelector {
-        fmt.Printf("  %ss=%s\n", key, val)
+    if event.Series != nil {
+        event.Count = event.Series.Count
+        event.LastTimestamp = metav1.NewTime(event.Series.LastObservedTime.Time)
     }
-
-
-    fmt.Println("Tolerations:")
-    for _, toleration := range pod.Spec.Tolerations {
-        fmt.Printf(
-            "  %s:%s op=%s\n",
-            toleration.Key,
-            toleration.Value,
-            toleration.Operator,
-        )
+    if event.LastTimestamp.IsZero() {
+        event.LastTimestamp = event.FirstTimestamp
     }
-
-    fmt.Println("Events:")
-    fmt.Printf(
-        "  %-7s %-12s %-5s %-18s %s\n",
-        "Type",
-        "Reason",
-        "Age",
-        "From",
-        "Message",
-    )
-    fmt.Printf(
-        "  %-7s %-12s %-5s %-18s %s\n",
-        "----",
-        "------",
-        "---",
-        "----",
-        "-------",
-    )
-    for _, event := range events.Items {
-        fmt.Printf("  %-7s %-12s %-5s %-18s %s\n",
-            event.Type,
-            event.Reason,
-            time.Since(event.LastTimestamp.Time).Round(time.Second),
-            event.Source.Component,
-            event.Message,
-        )
+    if event.Count == 0 {
+        event.Count = 1
     }
+    event.Series = nil
+    event.EventTime = metav1.MicroTime{}
 }
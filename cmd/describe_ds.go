@@ -0,0 +1,283 @@
+package cmd
+
+import (
+    "context"
+    "fmt"
+    "sort"
+    "strings"
+
+    appsv1 "k8s.io/api/apps/v1"
+    v1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/client-go/kubernetes"
+    "k8s.io/kubectl/pkg/describe"
+)
+
+// The annotation 'kubectl rollout history' shows as CHANGE-CAUSE
+const changeCauseAnnotation = "kubernetes.io/change-cause"
+
+// The time format kubectl's describers use
+const timeFormat = "Mon, 02 Jan 2006 15:04:05 -0700"
+
+// parseDaemonSetArg recognizes the ds/<name> form of a daemonset argument.
+func parseDaemonSetArg(arg string) (string, bool) {
+    kind, name, found := strings.Cut(arg, "/")
+    if !found {
+        return arg, false
+    }
+    switch strings.ToLower(kind) {
+    case "ds", "daemonset", "daemonsets", "daemonset.apps", "daemonsets.apps":
+        return name, true
+    }
+    return arg, false
+}
+
+// describeDaemonSet is 'kubectl describe ds', plus the things we always end
+// up looking up next: how the daemonset rolls, how many nodes it should be
+// on, and which revisions are out there. With a node, the pod and node
+// that we're probably being paged about are added as well.
+func (sv *dshCmd) describeDaemonSet(
+    ccontext string, namespace string, name string, nodeName string,
+    opts describeOptions,
+) error {
+    clientset, config, err := getClientSet(ccontext)
+    if err != nil {
+        return err
+    }
+
+    ds, err := clientset.AppsV1().DaemonSets(namespace).Get(
+        context.TODO(), name, metav1.GetOptions{},
+    )
+    if err != nil {
+        return err
+    }
+
+    describer := &describe.DaemonSetDescriber{Interface: clientset}
+    text, err := describer.Describe(
+        namespace, name, describe.DescriberSettings{},
+    )
+    if err != nil {
+        return err
+    }
+    fmt.Fprint(sv.out, text)
+
+    revisions, err := getDaemonSetRevisions(clientset, ds)
+    if err != nil {
+        return err
+    }
+
+    var events *v1.EventList
+    if opts.showEvents {
+        events, err = getEvents(
+            clientset, namespace, "DaemonSet", ds.Name, ds.UID,
+        )
+        if err != nil {
+            return err
+        }
+    }
+
+    err = describeTo(sv.out, func(w describe.PrefixWriter) {
+        describeUpdateStrategy(ds, w)
+        describeEligibility(ds, w)
+        describeRevisions(revisions, w)
+        if events != nil {
+            describe.DescribeEvents(events, w)
+        }
+    })
+    if err != nil {
+        return err
+    }
+
+    if nodeName == "" {
+        return nil
+    }
+
+    pods, err := getPodsForDaemonSet(clientset, name, namespace, nodeName)
+    if err != nil {
+        return err
+    }
+    fmt.Fprintf(sv.out, "\nPod on node %s:\n", nodeName)
+    if len(pods) == 0 {
+        fmt.Fprintf(sv.out, "  <none>\n")
+    }
+    for i := range pods {
+        err := sv.describePod(clientset, config, namespace, &pods[i], opts)
+        if err != nil {
+            return err
+        }
+    }
+
+    node, err := clientset.CoreV1().Nodes().Get(
+        context.TODO(), nodeName, metav1.GetOptions{},
+    )
+    if err != nil {
+        return err
+    }
+    fmt.Fprintln(sv.out)
+    return describeTo(sv.out, func(w describe.PrefixWriter) {
+        w.Write(describe.LEVEL_0, "Node:\t%s\n", node.Name)
+        describeNodeConditions(node, w)
+    })
+}
+
+func describeUpdateStrategy(ds *appsv1.DaemonSet, w describe.PrefixWriter) {
+    strategy := ds.Spec.UpdateStrategy
+    w.Write(describe.LEVEL_0, "Update Strategy:\t%s\n", strategy.Type)
+    if strategy.RollingUpdate != nil {
+        ru := strategy.RollingUpdate
+        if ru.MaxUnavailable != nil {
+            w.Write(
+                describe.LEVEL_1, "Max Unavailable:\t%s\n",
+                ru.MaxUnavailable.String(),
+            )
+        }
+        if ru.MaxSurge != nil {
+            w.Write(
+                describe.LEVEL_1, "Max Surge:\t%s\n", ru.MaxSurge.String(),
+            )
+        }
+    }
+    w.Write(
+        describe.LEVEL_0, "Min Ready Seconds:\t%d\n", ds.Spec.MinReadySeconds,
+    )
+}
+
+func describeEligibility(ds *appsv1.DaemonSet, w describe.PrefixWriter) {
+    status := ds.Status
+    w.Write(describe.LEVEL_0, "Node Eligibility:\n")
+    w.Write(describe.LEVEL_1, "Eligible:\t%d\n", status.DesiredNumberScheduled)
+    w.Write(
+        describe.LEVEL_1, "Scheduled:\t%d\n", status.CurrentNumberScheduled,
+    )
+    w.Write(
+        describe.LEVEL_1, "Missing:\t%d\n",
+        status.DesiredNumberScheduled-status.CurrentNumberScheduled,
+    )
+    w.Write(describe.LEVEL_1, "Misscheduled:\t%d\n", status.NumberMisscheduled)
+    w.Write(describe.LEVEL_1, "Ready:\t%d\n", status.NumberReady)
+    w.Write(describe.LEVEL_1, "Up-to-date:\t%d\n", status.UpdatedNumberScheduled)
+    w.Write(describe.LEVEL_1, "Unavailable:\t%d\n", status.NumberUnavailable)
+}
+
+// daemonSetRevision is a ControllerRevision of a daemonset, along with how
+// many of its pods are running it.
+type daemonSetRevision struct {
+    revision *appsv1.ControllerRevision
+    hash     string
+    pods     int
+}
+
+// getDaemonSetRevisions returns the revisions of ds, newest first. The
+// daemonset controller always makes the current revision the newest one.
+func getDaemonSetRevisions(
+    clientset *kubernetes.Clientset, ds *appsv1.DaemonSet,
+) ([]daemonSetRevision, error) {
+    selector, err := metav1.LabelSelectorAsSelector(ds.Spec.Selector)
+    if err != nil {
+        return nil, err
+    }
+    listOptions := metav1.ListOptions{LabelSelector: selector.String()}
+
+    history, err := clientset.AppsV1().ControllerRevisions(ds.Namespace).List(
+        context.TODO(), listOptions,
+    )
+    if err != nil {
+        return nil, err
+    }
+    podList, err := clientset.CoreV1().Pods(ds.Namespace).List(
+        context.TODO(), listOptions,
+    )
+    if err != nil {
+        return nil, err
+    }
+    podsByHash := make(map[string]int)
+    for i := range podList.Items {
+        pod := &podList.Items[i]
+        if daemonSetOwner(pod, ds.Name) != "" {
+            podsByHash[pod.Labels[appsv1.DefaultDaemonSetUniqueLabelKey]]++
+        }
+    }
+
+    var revisions []daemonSetRevision
+    for i := range history.Items {
+        revision := &history.Items[i]
+        if !metav1.IsControlledBy(revision, ds) {
+            continue
+        }
+        hash := revision.Labels[appsv1.DefaultDaemonSetUniqueLabelKey]
+        revisions = append(revisions, daemonSetRevision{
+            revision: revision,
+            hash:     hash,
+            pods:     podsByHash[hash],
+        })
+    }
+    sort.Slice(revisions, func(i, j int) bool {
+        return revisions[i].revision.Revision > revisions[j].revision.Revision
+    })
+    return revisions, nil
+}
+
+func describeRevisions(
+    revisions []daemonSetRevision, w describe.PrefixWriter,
+) {
+    if len(revisions) == 0 {
+        w.Write(describe.LEVEL_0, "Revisions:\t<none>\n")
+        return
+    }
+    w.Write(describe.LEVEL_0, "Revisions:\n")
+    w.Write(describe.LEVEL_1, "Revision\tHash\tAge\tPods\tChange-Cause\n")
+    w.Write(describe.LEVEL_1, "--------\t----\t---\t----\t------------\n")
+    // current and previous are the ones anybody cares about
+    for i, revision := range revisions {
+        if i > 1 {
+            break
+        }
+        label := "current"
+        if i == 1 {
+            label = "previous"
+        }
+        w.Write(
+            describe.LEVEL_1, "%d (%s)\t%s\t%s\t%d\t%s\n",
+            revision.revision.Revision, label, revision.hash,
+            translateTimestampSince(revision.revision.CreationTimestamp),
+            revision.pods,
+            orNone(revision.revision.Annotations[changeCauseAnnotation]),
+        )
+    }
+}
+
+// describeNodeConditions prints a node's conditions the same way
+// 'kubectl describe node' does.
+func describeNodeConditions(node *v1.Node, w describe.PrefixWriter) {
+    if len(node.Status.Conditions) == 0 {
+        w.Write(describe.LEVEL_0, "Conditions:\t<none>\n")
+        return
+    }
+    w.Write(describe.LEVEL_0, "Conditions:\n")
+    w.Write(
+        describe.LEVEL_1,
+        "Type\tStatus\tLastHeartbeatTime\tLastTransitionTime\tReason\tMessage\n",
+    )
+    w.Write(
+        describe.LEVEL_1,
+        "----\t------\t-----------------\t------------------\t------\t-------\n",
+    )
+    for _, c := range node.Status.Conditions {
+        w.Write(
+            describe.LEVEL_1, "%v \t%v \t%s \t%s \t%v \t%v\n",
+            c.Type, c.Status,
+            c.LastHeartbeatTime.Time.Format(timeFormat),
+            c.LastTransitionTime.Time.Format(timeFormat),
+            c.Reason, c.Message,
+        )
+    }
+    if node.Spec.Unschedulable {
+        w.Write(describe.LEVEL_0, "Unschedulable:\ttrue\n")
+    }
+    if len(node.Spec.Taints) > 0 {
+        w.Write(describe.LEVEL_0, "Taints:\n")
+        for _, taint := range node.Spec.Taints {
+            w.Write(describe.LEVEL_1, "%s\n", taint.ToString())
+        }
+    }
+}
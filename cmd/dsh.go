@@ -3,23 +3,58 @@ package cmd
 import (
     "github.com/spf13/cobra"
     "io"
-    
+
     "k8s.io/cli-runtime/pkg/genericclioptions"
 )
 
 type dshCmd struct {
-    out io.Writer
+    out    io.Writer
+    // the config file, for the commands that need it
+    config *dshConfig
+}
+
+// Execute runs the command args, after the command aliases in the config
+// file are expanded.
+func Execute(streams genericclioptions.IOStreams, args []string) error {
+    config, configErr := loadConfig()
+    dshCmd := newDshCommand(streams, config, configErr)
+    if configErr == nil {
+        args = expandCommandAlias(dshCmd, args, config.Aliases.Commands)
+    }
+    commandLine = args
+    dshCmd.SetArgs(args)
+    return dshCmd.Execute()
 }
 
+// NewDshCommand builds the commands with the config file, for callers that
+// set their own args. Execute is what runs the command line.
 func NewDshCommand(streams genericclioptions.IOStreams) *cobra.Command {
+    config, configErr := loadConfig()
+    return newDshCommand(streams, config, configErr)
+}
+
+// newDshCommand builds the commands with config, the config file. If there
+// was configErr reading it, that's only an error once we know we're running
+// a command, and not just building them for, say, completion.
+func newDshCommand(
+    streams genericclioptions.IOStreams, config *dshConfig, configErr error,
+) *cobra.Command {
     var context string
     var namespace string
     var nodeName string
+    var readOnly bool
 
     dshCmd := &cobra.Command{
         Use: "d <subcommand>",
         Short: "Various helpers for daemonsets",
         SilenceUsage: true,
+        CompletionOptions: cobra.CompletionOptions{DisableDefaultCmd: true},
+        PersistentPreRunE: func(c *cobra.Command, args []string) error {
+            if configErr != nil {
+                return configErr
+            }
+            return config.applyDefaults(c, args, context, &namespace)
+        },
         RunE: func (c *cobra.Command, args []string) error {
             return nil
         },
@@ -34,13 +69,81 @@ func NewDshCommand(streams genericclioptions.IOStreams) *cobra.Command {
     dshCmd.PersistentFlags().StringVarP(
         &nodeName, "node", "N", "", "Limit to pods on node",
     )
+    dshCmd.PersistentFlags().BoolVar(
+        &readOnly, "read-only", false,
+        "Refuse to run anything that changes things",
+    )
+
+    policy := &policyGuard{
+        out: streams.Out,
+        config: config,
+        context: &context,
+        namespace: &namespace,
+        readOnly: &readOnly,
+    }
 
     dshCmd.AddCommand(newVersionCommand(streams.Out))
+    dshCmd.AddCommand(newCompletionCommand(streams.Out))
+    dshCmd.AddCommand(newDshReplayCommand(streams.Out))
     dshCmd.AddCommand(newDshGetCommand(streams.Out, &context, &namespace, &nodeName))
-    dshCmd.AddCommand(newDshDeleteCommand(streams.Out, &context, &namespace, &nodeName))
+    dshCmd.AddCommand(policy.mutating(
+        newDshDeleteCommand(
+            streams.Out, &context, &namespace, &nodeName, config,
+        ),
+    ))
     dshCmd.AddCommand(newDshDescribeCommand(streams.Out, &context, &namespace, &nodeName))
     dshCmd.AddCommand(newDshLogCommand(streams.Out, &context, &namespace, &nodeName))
     dshCmd.AddCommand(newDshListCommand(streams.Out, &context, &namespace, &nodeName))
-    dshCmd.AddCommand(newDshExecCommand(streams.Out, &context, &namespace, &nodeName))
+    dshCmd.AddCommand(policy.mutating(
+        newDshExecCommand(
+            streams.Out, &context, &namespace, &nodeName, config,
+        ),
+    ))
+    dshCmd.AddCommand(policy.mutating(
+        newDshAttachCommand(
+            streams.Out, &context, &namespace, &nodeName, config,
+        ),
+    ))
+    dshCmd.AddCommand(policy.mutating(
+        newDshDebugCommand(
+            streams.Out, &context, &namespace, &nodeName, config,
+        ),
+    ))
+    dshCmd.AddCommand(policy.mutating(
+        newDshNodeShellCommand(streams.Out, &context, &namespace, &nodeName),
+    ))
+    dshCmd.AddCommand(newDshPortForwardCommand(streams.Out, &context, &namespace, &nodeName))
+    dshCmd.AddCommand(policy.mutating(
+        newDshCpCommand(streams.Out, &context, &namespace, &nodeName),
+    ))
+    dshCmd.AddCommand(policy.mutating(
+        newDshRunScriptCommand(streams.Out, &context, &namespace, &nodeName),
+    ))
+    dshCmd.AddCommand(newDshScrapeCommand(streams.Out, &context, &namespace, &nodeName))
+    dshCmd.AddCommand(policy.mutating(
+        newDshStaleConfigCommand(streams.Out, &context, &namespace, &nodeName),
+        "restart",
+    ))
+    dshCmd.AddCommand(policy.mutating(
+        newDshMaintainCommand(
+            streams.Out, &context, &namespace, &nodeName, config,
+        ),
+    ))
+    dshCmd.AddCommand(policy.mutating(
+        newDshRestartNodeCommand(
+            streams.Out, &context, &namespace, &nodeName, config,
+        ),
+    ))
+    dshCmd.AddCommand(newDshCanICommand(streams.Out, &context, &namespace, &nodeName))
+    dshCmd.AddCommand(newDshAuditCommand(
+        streams.Out, &context, &namespace, &nodeName, config,
+    ))
+
+    completions := &completer{
+        config: config,
+        context: &context,
+        namespace: &namespace,
+    }
+    completions.register(dshCmd)
     return dshCmd
 }
@@ -0,0 +1,539 @@
+package cmd
+
+import (
+    "context"
+    "fmt"
+    "sort"
+    "strings"
+
+    v1 "k8s.io/api/core/v1"
+    apierrors "k8s.io/apimachinery/pkg/api/errors"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/client-go/kubernetes"
+    "k8s.io/client-go/rest"
+    "k8s.io/kubectl/pkg/describe"
+    "k8s.io/kubectl/pkg/util/fieldpath"
+    "k8s.io/kubectl/pkg/util/resource"
+)
+
+const redacted = "<redacted>"
+
+// resolvedEnvVar is an environment variable as the container sees it.
+type resolvedEnvVar struct {
+    Name     string `json:"name"`
+    Value    string `json:"value"`
+    Source   string `json:"source"`
+    Redacted bool   `json:"redacted,omitempty"`
+}
+
+type containerEnv struct {
+    Container string           `json:"container"`
+    Env       []resolvedEnvVar `json:"env"`
+}
+
+// mountedConfig is a ConfigMap or Secret that a pod mounts as a volume.
+type mountedConfig struct {
+    Volume          string `json:"volume"`
+    Kind            string `json:"kind"`
+    Name            string `json:"name"`
+    ResourceVersion string `json:"resourceVersion,omitempty"`
+    Error           string `json:"error,omitempty"`
+}
+
+// envResolver works out the environment of a pod's containers the way the
+// kubelet on the pod's node would. ConfigMaps, Secrets and the node are
+// fetched at most once.
+type envResolver struct {
+    clientset   *kubernetes.Clientset
+    config      *rest.Config
+    pod         *v1.Pod
+    showSecrets bool
+
+    configMaps map[string]*v1.ConfigMap
+    secrets    map[string]*v1.Secret
+    errors     map[string]error
+    node       *v1.Node
+}
+
+func newEnvResolver(
+    clientset *kubernetes.Clientset, config *rest.Config, pod *v1.Pod,
+    showSecrets bool,
+) *envResolver {
+    return &envResolver{
+        clientset:   clientset,
+        config:      config,
+        pod:         pod,
+        showSecrets: showSecrets,
+        configMaps:  make(map[string]*v1.ConfigMap),
+        secrets:     make(map[string]*v1.Secret),
+        errors:      make(map[string]error),
+    }
+}
+
+func (r *envResolver) configMap(name string) (*v1.ConfigMap, error) {
+    key := "configmap/" + name
+    if err, ok := r.errors[key]; ok {
+        return nil, err
+    }
+    if cm, ok := r.configMaps[name]; ok {
+        return cm, nil
+    }
+    cm, err := r.clientset.CoreV1().ConfigMaps(r.pod.Namespace).Get(
+        context.TODO(), name, metav1.GetOptions{},
+    )
+    if err != nil {
+        r.errors[key] = err
+        return nil, err
+    }
+    r.configMaps[name] = cm
+    return cm, nil
+}
+
+func (r *envResolver) secret(name string) (*v1.Secret, error) {
+    key := "secret/" + name
+    if err, ok := r.errors[key]; ok {
+        return nil, err
+    }
+    if secret, ok := r.secrets[name]; ok {
+        return secret, nil
+    }
+    secret, err := r.clientset.CoreV1().Secrets(r.pod.Namespace).Get(
+        context.TODO(), name, metav1.GetOptions{},
+    )
+    if err != nil {
+        r.errors[key] = err
+        return nil, err
+    }
+    r.secrets[name] = secret
+    return secret, nil
+}
+
+// resolveAll resolves the environment of every container in the pod,
+// including init and ephemeral containers.
+func (r *envResolver) resolveAll() []containerEnv {
+    var envs []containerEnv
+    for _, container := range r.pod.Spec.InitContainers {
+        envs = append(envs, r.resolveContainer(container))
+    }
+    for _, container := range r.pod.Spec.Containers {
+        envs = append(envs, r.resolveContainer(container))
+    }
+    for _, ec := range r.pod.Spec.EphemeralContainers {
+        container := v1.Container(ec.EphemeralContainerCommon)
+        envs = append(envs, r.resolveContainer(container))
+    }
+    return envs
+}
+
+// resolveContainer resolves envFrom first and env second, since the latter
+// wins when both set the same variable, and expands $(VAR) references.
+func (r *envResolver) resolveContainer(container v1.Container) containerEnv {
+    var vars []resolvedEnvVar
+    index := make(map[string]int)
+    set := func(v resolvedEnvVar) {
+        if i, ok := index[v.Name]; ok {
+            vars[i] = v
+            return
+        }
+        index[v.Name] = len(vars)
+        vars = append(vars, v)
+    }
+
+    for _, from := range container.EnvFrom {
+        for _, v := range r.resolveEnvFrom(from) {
+            set(v)
+        }
+    }
+
+    values := make(map[string]string)
+    for _, v := range vars {
+        values[v.Name] = v.Value
+    }
+    for _, e := range container.Env {
+        v, ok := r.resolveEnvVar(container, e)
+        if !ok {
+            continue
+        }
+        if e.ValueFrom == nil {
+            v.Value = expandEnv(e.Value, values)
+        }
+        values[v.Name] = v.Value
+        set(v)
+    }
+
+    return containerEnv{Container: container.Name, Env: vars}
+}
+
+func (r *envResolver) resolveEnvFrom(from v1.EnvFromSource) []resolvedEnvVar {
+    var vars []resolvedEnvVar
+    switch {
+    case from.ConfigMapRef != nil:
+        name := from.ConfigMapRef.Name
+        source := fmt.Sprintf("configmap %s", name)
+        cm, err := r.configMap(name)
+        if err != nil {
+            if isOptional(from.ConfigMapRef.Optional) &&
+                apierrors.IsNotFound(err) {
+                return nil
+            }
+            return []resolvedEnvVar{{
+                Name: from.Prefix + "*", Value: errorValue(err), Source: source,
+            }}
+        }
+        for _, key := range sortedKeys(cm.Data) {
+            vars = append(vars, resolvedEnvVar{
+                Name: from.Prefix + key, Value: cm.Data[key], Source: source,
+            })
+        }
+        // the kubelet only puts data in the environment, but a key that's
+        // in binaryData instead is easily mistaken for one that's there
+        binaryKeys := make([]string, 0, len(cm.BinaryData))
+        for key := range cm.BinaryData {
+            binaryKeys = append(binaryKeys, key)
+        }
+        sort.Strings(binaryKeys)
+        for _, key := range binaryKeys {
+            vars = append(vars, resolvedEnvVar{
+                Name:   from.Prefix + key,
+                Value:  "<not set, binaryData isn't put in the environment>",
+                Source: source + " binaryData",
+            })
+        }
+    case from.SecretRef != nil:
+        name := from.SecretRef.Name
+        source := fmt.Sprintf("secret %s", name)
+        if !r.showSecrets {
+            // we'd only redact what we read, so there's no need to
+            return []resolvedEnvVar{{
+                Name: from.Prefix + "*", Value: redacted, Source: source,
+                Redacted: true,
+            }}
+        }
+        secret, err := r.secret(name)
+        if err != nil {
+            if isOptional(from.SecretRef.Optional) &&
+                apierrors.IsNotFound(err) {
+                return nil
+            }
+            return []resolvedEnvVar{{
+                Name: from.Prefix + "*", Value: errorValue(err), Source: source,
+            }}
+        }
+        keys := make([]string, 0, len(secret.Data))
+        for key := range secret.Data {
+            keys = append(keys, key)
+        }
+        sort.Strings(keys)
+        for _, key := range keys {
+            vars = append(vars, r.secretValue(
+                from.Prefix+key, string(secret.Data[key]), source,
+            ))
+        }
+    }
+    return vars
+}
+
+// resolveEnvVar resolves e, or says the kubelet leaves it unset, as it does
+// when an optional ConfigMap or Secret, or key in one, doesn't exist.
+func (r *envResolver) resolveEnvVar(
+    container v1.Container, e v1.EnvVar,
+) (resolvedEnvVar, bool) {
+    if e.ValueFrom == nil {
+        return resolvedEnvVar{
+            Name: e.Name, Value: e.Value, Source: "value",
+        }, true
+    }
+
+    from := e.ValueFrom
+    switch {
+    case from.FieldRef != nil:
+        return resolvedEnvVar{
+            Name:   e.Name,
+            Value:  podFieldValue(r.pod, from.FieldRef.FieldPath),
+            Source: fmt.Sprintf("field %s", from.FieldRef.FieldPath),
+        }, true
+    case from.ResourceFieldRef != nil:
+        return resolvedEnvVar{
+            Name:   e.Name,
+            Value:  r.resourceFieldValue(container, from.ResourceFieldRef),
+            Source: fmt.Sprintf("resource %s", from.ResourceFieldRef.Resource),
+        }, true
+    case from.ConfigMapKeyRef != nil:
+        ref := from.ConfigMapKeyRef
+        source := fmt.Sprintf("configmap %s key %s", ref.Name, ref.Key)
+        cm, err := r.configMap(ref.Name)
+        if err != nil {
+            if isOptional(ref.Optional) && apierrors.IsNotFound(err) {
+                return resolvedEnvVar{}, false
+            }
+            return resolvedEnvVar{
+                Name: e.Name, Value: errorValue(err), Source: source,
+            }, true
+        }
+        value, ok := cm.Data[ref.Key]
+        if !ok {
+            if isOptional(ref.Optional) {
+                return resolvedEnvVar{}, false
+            }
+            value = "<error: key not found>"
+        }
+        return resolvedEnvVar{Name: e.Name, Value: value, Source: source}, true
+    case from.SecretKeyRef != nil:
+        ref := from.SecretKeyRef
+        source := fmt.Sprintf("secret %s key %s", ref.Name, ref.Key)
+        if !r.showSecrets {
+            return r.secretValue(e.Name, "", source), true
+        }
+        secret, err := r.secret(ref.Name)
+        if err != nil {
+            if isOptional(ref.Optional) && apierrors.IsNotFound(err) {
+                return resolvedEnvVar{}, false
+            }
+            return resolvedEnvVar{
+                Name: e.Name, Value: errorValue(err), Source: source,
+            }, true
+        }
+        value, ok := secret.Data[ref.Key]
+        if !ok {
+            if isOptional(ref.Optional) {
+                return resolvedEnvVar{}, false
+            }
+            return resolvedEnvVar{
+                Name: e.Name, Value: "<error: key not found>", Source: source,
+            }, true
+        }
+        return r.secretValue(e.Name, string(value), source), true
+    }
+    return resolvedEnvVar{Name: e.Name, Source: "unknown"}, true
+}
+
+// podFieldValue resolves a downward API field the way the kubelet does; the
+// fields that only exist at runtime aren't handled by fieldpath.
+func podFieldValue(pod *v1.Pod, fieldPath string) string {
+    switch fieldPath {
+    case "spec.nodeName":
+        return pod.Spec.NodeName
+    case "spec.serviceAccountName":
+        return pod.Spec.ServiceAccountName
+    case "status.hostIP":
+        return pod.Status.HostIP
+    case "status.hostIPs":
+        var ips []string
+        for _, ip := range pod.Status.HostIPs {
+            ips = append(ips, ip.IP)
+        }
+        return strings.Join(ips, ",")
+    case "status.podIP":
+        return pod.Status.PodIP
+    case "status.podIPs":
+        var ips []string
+        for _, ip := range pod.Status.PodIPs {
+            ips = append(ips, ip.IP)
+        }
+        return strings.Join(ips, ",")
+    }
+    value, err := fieldpath.ExtractFieldPathAsString(pod, fieldPath)
+    if err != nil {
+        return errorValue(err)
+    }
+    return value
+}
+
+func (r *envResolver) secretValue(
+    name string, value string, source string,
+) resolvedEnvVar {
+    if r.showSecrets {
+        return resolvedEnvVar{Name: name, Value: value, Source: source}
+    }
+    return resolvedEnvVar{
+        Name: name, Value: redacted, Source: source, Redacted: true,
+    }
+}
+
+// resourceFieldValue resolves a resourceFieldRef. Unset limits default to
+// what's allocatable on the node, which is where we need the node.
+func (r *envResolver) resourceFieldValue(
+    container v1.Container, ref *v1.ResourceFieldSelector,
+) string {
+    c := container.DeepCopy()
+    resourceName := v1.ResourceName(strings.TrimPrefix(ref.Resource, "limits."))
+    if strings.HasPrefix(ref.Resource, "limits.") {
+        if _, ok := c.Resources.Limits[resourceName]; !ok {
+            if node, err := r.getNode(); err == nil {
+                if allocatable, ok := node.Status.Allocatable[resourceName]; ok {
+                    if c.Resources.Limits == nil {
+                        c.Resources.Limits = v1.ResourceList{}
+                    }
+                    c.Resources.Limits[resourceName] = allocatable
+                }
+            }
+        }
+    }
+    value, err := resource.ExtractContainerResourceValue(ref, c)
+    if err != nil {
+        return errorValue(err)
+    }
+    return value
+}
+
+func (r *envResolver) getNode() (*v1.Node, error) {
+    if r.node != nil {
+        return r.node, nil
+    }
+    node, err := r.clientset.CoreV1().Nodes().Get(
+        context.TODO(), r.pod.Spec.NodeName, metav1.GetOptions{},
+    )
+    if err != nil {
+        return nil, err
+    }
+    r.node = node
+    return node, nil
+}
+
+// mountedConfigs lists the ConfigMaps and Secrets the pod mounts as volumes,
+// directly or through a projected volume. Unless we're showing secrets, only
+// the metadata of Secrets is read.
+func (r *envResolver) mountedConfigs() []mountedConfig {
+    var mounted []mountedConfig
+    add := func(volume string, kind string, name string) {
+        m := mountedConfig{Volume: volume, Kind: kind, Name: name}
+        var meta metav1.Object
+        var err error
+        switch {
+        case kind == "ConfigMap":
+            var cm *v1.ConfigMap
+            if cm, err = r.configMap(name); err == nil {
+                meta = cm
+            }
+        case r.showSecrets:
+            var secret *v1.Secret
+            if secret, err = r.secret(name); err == nil {
+                meta = secret
+            }
+        default:
+            var partial *metav1.PartialObjectMetadata
+            partial, err = getConfigMetadata(
+                r.config, r.pod.Namespace, kind, name,
+            )
+            if err == nil {
+                meta = partial
+            }
+        }
+        if err != nil {
+            m.Error = err.Error()
+        } else {
+            m.ResourceVersion = meta.GetResourceVersion()
+        }
+        mounted = append(mounted, m)
+    }
+
+    for _, volume := range r.pod.Spec.Volumes {
+        switch {
+        case volume.ConfigMap != nil:
+            add(volume.Name, "ConfigMap", volume.ConfigMap.Name)
+        case volume.Secret != nil:
+            add(volume.Name, "Secret", volume.Secret.SecretName)
+        case volume.Projected != nil:
+            for _, source := range volume.Projected.Sources {
+                if source.ConfigMap != nil {
+                    add(volume.Name, "ConfigMap", source.ConfigMap.Name)
+                }
+                if source.Secret != nil {
+                    add(volume.Name, "Secret", source.Secret.Name)
+                }
+            }
+        }
+    }
+    return mounted
+}
+
+// describeResolvedEnv adds what --resolve-env found to a describe.
+func describeResolvedEnv(
+    envs []containerEnv, mounted []mountedConfig, w describe.PrefixWriter,
+) {
+    w.Write(describe.LEVEL_0, "Resolved Environment:\n")
+    for _, env := range envs {
+        if len(env.Env) == 0 {
+            w.Write(describe.LEVEL_1, "%s:\t<none>\n", env.Container)
+            continue
+        }
+        w.Write(describe.LEVEL_1, "%s:\n", env.Container)
+        for _, v := range env.Env {
+            w.Write(
+                describe.LEVEL_2, "%s:\t%s\t(%s)\n", v.Name, v.Value, v.Source,
+            )
+        }
+    }
+
+    if len(mounted) == 0 {
+        w.Write(describe.LEVEL_0, "Mounted Config:\t<none>\n")
+        return
+    }
+    w.Write(describe.LEVEL_0, "Mounted Config:\n")
+    w.Write(describe.LEVEL_1, "Volume\tKind\tName\tResourceVersion\n")
+    w.Write(describe.LEVEL_1, "------\t----\t----\t---------------\n")
+    for _, m := range mounted {
+        version := m.ResourceVersion
+        if m.Error != "" {
+            version = fmt.Sprintf("<error: %s>", m.Error)
+        }
+        w.Write(
+            describe.LEVEL_1, "%s\t%s\t%s\t%s\n",
+            m.Volume, m.Kind, m.Name, version,
+        )
+    }
+}
+
+// expandEnv expands $(VAR) references to variables defined before it, the
+// same way the kubelet does: unknown references are left alone, and $$ is
+// an escaped $.
+func expandEnv(value string, values map[string]string) string {
+    var b strings.Builder
+    for i := 0; i < len(value); i++ {
+        if value[i] != '$' || i+1 >= len(value) {
+            b.WriteByte(value[i])
+            continue
+        }
+        switch value[i+1] {
+        case '$':
+            b.WriteByte('$')
+            i++
+        case '(':
+            end := strings.IndexByte(value[i+2:], ')')
+            if end < 0 {
+                b.WriteByte(value[i])
+                continue
+            }
+            name := value[i+2 : i+2+end]
+            if v, ok := values[name]; ok {
+                b.WriteString(v)
+            } else {
+                b.WriteString(value[i : i+3+end])
+            }
+            i += 2 + end
+        default:
+            b.WriteByte(value[i])
+        }
+    }
+    return b.String()
+}
+
+func isOptional(optional *bool) bool {
+    return optional != nil && *optional
+}
+
+func errorValue(err error) string {
+    if apierrors.IsForbidden(err) {
+        return "<forbidden>"
+    }
+    return fmt.Sprintf("<error: %v>", err)
+}
+
+func sortedKeys(m map[string]string) []string {
+    keys := make([]string, 0, len(m))
+    for key := range m {
+        keys = append(keys, key)
+    }
+    sort.Strings(keys)
+    return keys
+}
@@ -0,0 +1,240 @@
+package cmd
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "path"
+    "strings"
+    "testing"
+
+    v1 "k8s.io/api/core/v1"
+    apierrors "k8s.io/apimachinery/pkg/api/errors"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/runtime/schema"
+    "k8s.io/client-go/kubernetes"
+    "k8s.io/client-go/rest"
+)
+
+func TestExpandEnv(t *testing.T) {
+    values := map[string]string{"HOST": "node-1", "PORT": "8080", "EMPTY": ""}
+    tests := []struct {
+        value string
+        want  string
+    }{
+        {"plain", "plain"},
+        {"$(HOST):$(PORT)", "node-1:8080"},
+        {"x$(EMPTY)y", "xy"},
+        {"$(UNKNOWN)", "$(UNKNOWN)"},
+        {"$$(HOST)", "$(HOST)"},
+        {"$$$(HOST)", "$node-1"},
+        {"cost: $5", "cost: $5"},
+        {"trailing $", "trailing $"},
+        {"$(HOST", "$(HOST"},
+        {"$(HOST)$(", "node-1$("},
+    }
+    for _, tt := range tests {
+        if got := expandEnv(tt.value, values); got != tt.want {
+            t.Errorf("expandEnv(%q) = %q, want %q", tt.value, got, tt.want)
+        }
+    }
+}
+
+// testEnvResolver resolves against a stand-in API server with configMaps,
+// and fails the test if a Secret is read.
+func testEnvResolver(
+    t *testing.T, configMaps map[string]*v1.ConfigMap,
+) *envResolver {
+    server := httptest.NewServer(http.HandlerFunc(
+        func(w http.ResponseWriter, r *http.Request) {
+            w.Header().Set("Content-Type", "application/json")
+            dir, name := path.Split(r.URL.Path)
+            var body any
+            switch {
+            case strings.HasSuffix(dir, "/secrets/"):
+                t.Errorf("read secret %s without --show-secrets", name)
+                w.WriteHeader(http.StatusInternalServerError)
+                return
+            case configMaps[name] != nil:
+                body = configMaps[name]
+            default:
+                status := apierrors.NewNotFound(
+                    schema.GroupResource{Resource: "configmaps"}, name,
+                ).Status()
+                w.WriteHeader(http.StatusNotFound)
+                body = &status
+            }
+            json.NewEncoder(w).Encode(body)
+        },
+    ))
+    t.Cleanup(server.Close)
+
+    config := &rest.Config{Host: server.URL}
+    clientset, err := kubernetes.NewForConfig(config)
+    if err != nil {
+        t.Fatal(err)
+    }
+    pod := &v1.Pod{
+        ObjectMeta: metav1.ObjectMeta{Name: "agent-a", Namespace: "infra"},
+        Spec:       v1.PodSpec{NodeName: "node-1"},
+    }
+    return newEnvResolver(clientset, config, pod, false)
+}
+
+func TestResolveEnvVar(t *testing.T) {
+    optional := true
+    configMapKey := func(
+        name string, key string, optional *bool,
+    ) *v1.EnvVarSource {
+        return &v1.EnvVarSource{ConfigMapKeyRef: &v1.ConfigMapKeySelector{
+            LocalObjectReference: v1.LocalObjectReference{Name: name},
+            Key:                  key,
+            Optional:             optional,
+        }}
+    }
+
+    r := testEnvResolver(t, map[string]*v1.ConfigMap{
+        "agent": {
+            ObjectMeta: metav1.ObjectMeta{Name: "agent", Namespace: "infra"},
+            Data:       map[string]string{"level": "debug"},
+        },
+    })
+
+    tests := []struct {
+        name  string
+        env   v1.EnvVar
+        want  resolvedEnvVar
+        unset bool
+    }{
+        {
+            name: "value",
+            env:  v1.EnvVar{Name: "MODE", Value: "fast"},
+            want: resolvedEnvVar{Name: "MODE", Value: "fast", Source: "value"},
+        },
+        {
+            name: "field",
+            env: v1.EnvVar{Name: "NODE", ValueFrom: &v1.EnvVarSource{
+                FieldRef: &v1.ObjectFieldSelector{FieldPath: "spec.nodeName"},
+            }},
+            want: resolvedEnvVar{
+                Name: "NODE", Value: "node-1", Source: "field spec.nodeName",
+            },
+        },
+        {
+            name: "configmap key",
+            env: v1.EnvVar{
+                Name: "LEVEL", ValueFrom: configMapKey("agent", "level", nil),
+            },
+            want: resolvedEnvVar{
+                Name: "LEVEL", Value: "debug",
+                Source: "configmap agent key level",
+            },
+        },
+        {
+            name: "missing configmap key",
+            env: v1.EnvVar{
+                Name: "COLOR", ValueFrom: configMapKey("agent", "color", nil),
+            },
+            want: resolvedEnvVar{
+                Name: "COLOR", Value: "<error: key not found>",
+                Source: "configmap agent key color",
+            },
+        },
+        {
+            name: "missing optional configmap key",
+            env: v1.EnvVar{
+                Name:      "COLOR",
+                ValueFrom: configMapKey("agent", "color", &optional),
+            },
+            unset: true,
+        },
+        {
+            name: "missing optional configmap",
+            env: v1.EnvVar{
+                Name:      "COLOR",
+                ValueFrom: configMapKey("other", "color", &optional),
+            },
+            unset: true,
+        },
+        {
+            name: "secret without --show-secrets",
+            env: v1.EnvVar{Name: "TOKEN", ValueFrom: &v1.EnvVarSource{
+                SecretKeyRef: &v1.SecretKeySelector{
+                    LocalObjectReference: v1.LocalObjectReference{
+                        Name: "agent",
+                    },
+                    Key: "token",
+                },
+            }},
+            want: resolvedEnvVar{
+                Name: "TOKEN", Value: redacted,
+                Source: "secret agent key token", Redacted: true,
+            },
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got, ok := r.resolveEnvVar(v1.Container{Name: "agent"}, tt.env)
+            if ok == tt.unset {
+                t.Fatalf("got set %v, want %v", ok, !tt.unset)
+            }
+            if ok && got != tt.want {
+                t.Errorf("got %+v, want %+v", got, tt.want)
+            }
+        })
+    }
+
+    t.Run("missing configmap", func(t *testing.T) {
+        got, ok := r.resolveEnvVar(v1.Container{Name: "agent"}, v1.EnvVar{
+            Name: "COLOR", ValueFrom: configMapKey("other", "color", nil),
+        })
+        if !ok || !strings.HasPrefix(got.Value, "<error: ") {
+            t.Errorf("got %+v, %v, want an error value", got, ok)
+        }
+    })
+}
+
+func TestResolveContainer(t *testing.T) {
+    r := testEnvResolver(t, map[string]*v1.ConfigMap{
+        "agent": {
+            ObjectMeta: metav1.ObjectMeta{Name: "agent", Namespace: "infra"},
+            Data: map[string]string{"HOST": "db", "PORT": "5432"},
+            BinaryData: map[string][]byte{"CERT": []byte("...")},
+        },
+    })
+    container := v1.Container{
+        Name: "agent",
+        EnvFrom: []v1.EnvFromSource{
+            {ConfigMapRef: &v1.ConfigMapEnvSource{
+                LocalObjectReference: v1.LocalObjectReference{Name: "agent"},
+            }},
+            {Prefix: "S_", SecretRef: &v1.SecretEnvSource{
+                LocalObjectReference: v1.LocalObjectReference{Name: "agent"},
+            }},
+        },
+        Env: []v1.EnvVar{
+            {Name: "PORT", Value: "6432"},
+            {Name: "URL", Value: "$(HOST):$(PORT)/$(DB)"},
+        },
+    }
+
+    var got []string
+    for _, v := range r.resolveContainer(container).Env {
+        got = append(got, v.Name+"="+v.Value+" ("+v.Source+")")
+    }
+    want := []string{
+        "HOST=db (configmap agent)",
+        "PORT=6432 (value)",
+        "CERT=<not set, binaryData isn't put in the environment> " +
+            "(configmap agent binaryData)",
+        "S_*=<redacted> (secret agent)",
+        "URL=db:6432/$(DB) (value)",
+    }
+    if strings.Join(got, "\n") != strings.Join(want, "\n") {
+        t.Errorf(
+            "got\n%s\nwant\n%s",
+            strings.Join(got, "\n"), strings.Join(want, "\n"),
+        )
+    }
+}
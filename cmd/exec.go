@@ -8,23 +8,29 @@ import (
     "io"
     "os"
 
+    "k8s.io/client-go/kubernetes"
     "k8s.io/client-go/kubernetes/scheme"
+    "k8s.io/client-go/rest"
     "k8s.io/client-go/tools/remotecommand"
     "golang.org/x/term"
 
     v1 "k8s.io/api/core/v1"
+    "k8s.io/apimachinery/pkg/runtime"
 )
 
 
 func newDshExecCommand(
     out io.Writer, context *string, namespace *string, nodeName *string,
+    config *dshConfig,
 ) *cobra.Command {
     var container string
     var stdin bool
     var tty bool
+    var record string
 
     dshExec := &dshCmd{
-        out: out,
+        out:    out,
+        config: config,
     }
 
     cmd := &cobra.Command{
@@ -36,13 +42,14 @@ specified node.  To pass arguments to the command, use '--' followed by the
 command and its arguments. For example:
 
 kubectl d exec my-daemonset -c my-container -- echo "Hello, world!"`,
+        Annotations: map[string]string{daemonSetArgAnnotation: "true"},
         Args: cobra.MatchAll(cobra.MinimumNArgs(1)),
         RunE: func(cmd *cobra.Command, args []string) error {
             if len(args) > 1 && cmd.ArgsLenAtDash() != -1 {
                 remoteCommand := args[cmd.ArgsLenAtDash():]
                 return dshExec.execPod(
                     *context, *namespace, args[0], *nodeName, container, stdin,
-                    tty, remoteCommand,
+                    tty, record, remoteCommand,
                 )
             } else {
                 return errors.New("at least some command is required")
@@ -59,6 +66,7 @@ kubectl d exec my-daemonset -c my-container -- echo "Hello, world!"`,
     cmd.Flags().BoolVarP(
         &tty, "tty", "t", false, "Stdin is a TTY",
     )
+    addRecordFlag(cmd, &record)
     return cmd
 }
 
@@ -76,12 +84,16 @@ func (t *terminalSizeQueue) Next() *remotecommand.TerminalSize {
 
 func (sv *dshCmd) execPod(
     kcontext string, namespace string, ds string, nodeName string,
-    container string, stdin bool, tty bool, cmd []string,
+    container string, stdin bool, tty bool, record string, cmd []string,
 ) error {
     clientset, config, err := getClientSet(kcontext)
     if err != nil {
         return err
     }
+    err = preflight(clientset, namespace, permListPods, permExec)
+    if err != nil {
+        return err
+    }
 
     pods, err := getPodsForDaemonSet(clientset, ds, namespace, nodeName)
     if err != nil {
@@ -98,60 +110,14 @@ func (sv *dshCmd) execPod(
         return nil
     }
 
-    req := clientset.CoreV1().RESTClient().
-        Post().
-        Resource("pods").
-        Name(pods[0].Name).
-        Namespace(namespace).
-        SubResource("exec").
-        VersionedParams(&v1.PodExecOptions{
-            Command:   cmd,
-            Container: container,
-            Stdin:     stdin,
-            Stdout:    true,
-            Stderr:    true,
-            TTY:       tty,
-        }, scheme.ParameterCodec)
-
-    exec, err := remotecommand.NewSPDYExecutor(config, "POST", req.URL())
-    if err != nil {
-        return err
-    }
-
     var streamOptions remotecommand.StreamOptions
     if tty {
-        initialState, err := term.MakeRaw(int(os.Stdin.Fd()))
+        var restore func()
+        streamOptions, restore, err = ttyStreamOptions()
         if err != nil {
             return err
         }
-        defer func() {
-            if err := term.Restore(int(os.Stdin.Fd()), initialState); err != nil {
-                // Handle the error, e.g., log it or print it.
-                fmt.Fprintf(os.Stderr, "Error restoring terminal: %v\n", err)
-            }
-        }()
-
-        // This queue has to be made with size 1 so that sending the original
-        // size before there's a listener won't cause a freeze
-        sizeQueue := make(chan remotecommand.TerminalSize, 1)
-        tQueue := &terminalSizeQueue{sizeQueue: sizeQueue}
-
-        // Send the initial terminal size.
-        if width, height, err := term.GetSize(int(os.Stdin.Fd())); err == nil {
-            sizeQueue <- remotecommand.TerminalSize{
-                Width: uint16(width), Height: uint16(height),
-            }
-        }
-
-        go monitorTerminalResize(sizeQueue)
-
-        streamOptions = remotecommand.StreamOptions{
-            Stdin:             os.Stdin,
-            Stdout:            os.Stdout,
-            Stderr:            os.Stdout,
-            Tty:               tty,
-            TerminalSizeQueue: tQueue,
-        }
+        defer restore()
     } else {
         streamOptions = remotecommand.StreamOptions{
             Stdin:  os.Stdin,
@@ -165,9 +131,120 @@ func (sv *dshCmd) execPod(
         streamOptions.Stdin = nil
     }
 
-    ctx, cancel := context.WithCancel(context.Background())
-    defer cancel()
+    stopRecording, err := startRecording(
+        &sv.config.Record, kcontext, record, &pods[0], container, cmd, &streamOptions,
+    )
+    if err != nil {
+        return err
+    }
+    defer stopRecording()
 
-    err = exec.StreamWithContext(ctx, streamOptions)
+    err = streamExec(
+        clientset, config, namespace, pods[0].Name, container, cmd,
+        streamOptions,
+    )
+    auditPod("exec", &pods[0], err)
     return err
 }
+
+// ttyStreamOptions puts the local terminal in raw mode, and returns stream
+// options that connect it, and its size as it changes, to the other end. The
+// returned function puts the terminal back the way it was.
+func ttyStreamOptions() (remotecommand.StreamOptions, func(), error) {
+    initialState, err := term.MakeRaw(int(os.Stdin.Fd()))
+    if err != nil {
+        return remotecommand.StreamOptions{}, nil, err
+    }
+    restore := func() {
+        if err := term.Restore(int(os.Stdin.Fd()), initialState); err != nil {
+            // Handle the error, e.g., log it or print it.
+            fmt.Fprintf(os.Stderr, "Error restoring terminal: %v\n", err)
+        }
+    }
+
+    // This queue has to be made with size 1 so that sending the original
+    // size before there's a listener won't cause a freeze
+    sizeQueue := make(chan remotecommand.TerminalSize, 1)
+    tQueue := &terminalSizeQueue{sizeQueue: sizeQueue}
+
+    // Send the initial terminal size.
+    if width, height, err := term.GetSize(int(os.Stdin.Fd())); err == nil {
+        sizeQueue <- remotecommand.TerminalSize{
+            Width: uint16(width), Height: uint16(height),
+        }
+    }
+
+    go monitorTerminalResize(sizeQueue)
+
+    streamOptions := remotecommand.StreamOptions{
+        Stdin:             os.Stdin,
+        Stdout:            os.Stdout,
+        Stderr:            os.Stdout,
+        Tty:               true,
+        TerminalSizeQueue: tQueue,
+    }
+    return streamOptions, restore, nil
+}
+
+// streamExec runs cmd in container of pod, connecting it to the streams in
+// streamOptions. Stdin is only opened if streamOptions has one.
+func streamExec(
+    clientset *kubernetes.Clientset, config *rest.Config, namespace string,
+    pod string, container string, cmd []string,
+    streamOptions remotecommand.StreamOptions,
+) error {
+    return streamPod(
+        context.Background(), clientset, config, namespace, pod, "exec",
+        &v1.PodExecOptions{
+            Command:   cmd,
+            Container: container,
+            Stdin:     streamOptions.Stdin != nil,
+            Stdout:    streamOptions.Stdout != nil,
+            Stderr:    streamOptions.Stderr != nil,
+            TTY:       streamOptions.Tty,
+        }, streamOptions,
+    )
+}
+
+// streamAttach attaches the streams in streamOptions to the running
+// container of pod, until it exits or ctx is done.
+func streamAttach(
+    ctx context.Context, clientset *kubernetes.Clientset,
+    config *rest.Config, namespace string, pod string, container string,
+    streamOptions remotecommand.StreamOptions,
+) error {
+    return streamPod(
+        ctx, clientset, config, namespace, pod, "attach",
+        &v1.PodAttachOptions{
+            Container: container,
+            Stdin:     streamOptions.Stdin != nil,
+            Stdout:    streamOptions.Stdout != nil,
+            Stderr:    streamOptions.Stderr != nil,
+            TTY:       streamOptions.Tty,
+        }, streamOptions,
+    )
+}
+
+func streamPod(
+    ctx context.Context, clientset *kubernetes.Clientset,
+    config *rest.Config, namespace string, pod string, subresource string,
+    params runtime.Object, streamOptions remotecommand.StreamOptions,
+) error {
+    req := clientset.CoreV1().RESTClient().
+        Post().
+        Resource("pods").
+        Name(pod).
+        Namespace(namespace).
+        SubResource(subresource).
+        VersionedParams(params, scheme.ParameterCodec)
+
+    exec, err := remotecommand.NewSPDYExecutor(config, "POST", req.URL())
+    if err != nil {
+        return err
+    }
+
+    ctx, cancel := context.WithCancel(ctx)
+    defer cancel()
+
+    return exec.StreamWithContext(ctx, streamOptions)
+}
@@ -1,17 +1,17 @@
 package cmd
 
 import (
-    "encoding/json"
-    "gopkg.in/yaml.v3"
     "fmt"
     "github.com/spf13/cobra"
     "io"
-    "os"
-    "strings"
-    "time"
-    
+
+    "k8s.io/apimachinery/pkg/api/meta"
     metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/runtime"
     "k8s.io/cli-runtime/pkg/printers"
+    "k8s.io/client-go/kubernetes/scheme"
+    "k8s.io/kubectl/pkg/cmd/get"
+    appsv1 "k8s.io/api/apps/v1"
     v1 "k8s.io/api/core/v1"
 )
 
@@ -19,7 +19,9 @@ import (
 func newDshGetCommand(
     out io.Writer, context *string, namespace *string, nodeName *string,
 ) *cobra.Command {
-    var output string
+    printFlags := get.NewGetPrintFlags()
+    var watch bool
+    var watchOnly bool
 
     dshGet := &dshCmd{
         out: out,
@@ -32,149 +34,200 @@ func newDshGetCommand(
 `Get poddescribed matching a given daemonset and node. Any combination is allowed.
 If only a node is specified all pods owned by a daemonset on that node will be
 shown. If only a daemonset is specified, a all pods in that daemonset will
-be shown.`,
+be shown.
+
+All of the output formats of 'kubectl get' are supported. The json and yaml
+formats emit a single v1 List, so the output can be piped into
+'kubectl apply -f -' or 'kubectl delete -f -'.
+
+With --watch, a row is printed every time a matching pod is added, deleted, or
+changes its status, readiness or restarts, prefixed with the type of event.`,
+        Annotations: map[string]string{daemonSetArgAnnotation: "true"},
         Args: cobra.MatchAll(cobra.MaximumNArgs(1)),
         RunE: func(cmd *cobra.Command, args []string) error {
             ds := ""
             if len(args) == 1 {
                 ds = args[0]
             }
-            return dshGet.getPods(*context, *namespace, ds, *nodeName, output)
+            return dshGet.getPods(
+                *context, *namespace, ds, *nodeName, printFlags, watch,
+                watchOnly,
+            )
         },
     }
 
-    cmd.Flags().StringVarP(
-        &output, "output", "o", "", "Output format. One of wide, json, yaml.",
+    printFlags.AddFlags(cmd)
+    cmd.Flags().BoolVarP(
+        &watch, "watch", "w", false,
+        "After listing the pods, watch for changes",
+    )
+    cmd.Flags().BoolVar(
+        &watchOnly, "watch-only", false,
+        "Watch for changes without listing the pods first",
     )
 
     return cmd
 }
 
 func (sv *dshCmd) getPods(
-    context string, namespace string, ds string, nodeName string, output string,
+    context string, namespace string, ds string, nodeName string,
+    printFlags *get.PrintFlags, watch bool, watchOnly bool,
 ) error {
+    printer, err := getPrinter(printFlags)
+    if err != nil {
+        return err
+    }
+
     clientset, _, err := getClientSet(context)
     if err != nil {
         return err
     }
 
+    if watch || watchOnly {
+        return sv.watchPods(
+            clientset, namespace, ds, nodeName, printer, printFlags,
+            watchOnly,
+        )
+    }
+
     pods, err := getPodsForDaemonSet(clientset, ds, namespace, nodeName)
     if err != nil {
         return err
     }
 
+    if !isHumanOutput(printFlags) {
+        return printer.PrintObj(podsToList(pods), sv.out)
+    }
+
     if len(pods) == 0 {
         fmt.Printf("No pods found\n")
         return nil
     }
 
-    var table metav1.Table
-    var printer printers.ResourcePrinter
-    if output == "" || output == "wide" {
-        printer = printers.NewTablePrinter(printers.PrintOptions{})
-		switch output {
-		case "":
-            table = metav1.Table{
-                ColumnDefinitions: []metav1.TableColumnDefinition{
-                    {Name: "NAME"},
-                    {Name: "READY"},
-                    {Name: "STATUS"},
-                    {Name: "RESTARTS"},
-                    {Name: "AGE"},
-                },
-            }
-		case "wide":
-            // when I append(table.ColumnDefinitions, ...) I get
-            // syntax errors. No idea why.
-            table = metav1.Table{
-                ColumnDefinitions: []metav1.TableColumnDefinition{
-                    {Name: "NAME"},
-                    {Name: "READY"},
-                    {Name: "STATUS"},
-                    {Name: "RESTARTS"},
-                    {Name: "AGE"},
-                    {Name: "IP"},
-                    {Name: "NODE"},
-                    {Name: "NOMINATED NODE"},
-                    {Name: "READINESS GATES"},
-                },
-            }
-		}
-    }
+    return printer.PrintObj(podsToTable(pods), sv.out)
+}
 
-    for _, pod := range pods {
-        switch output {
-        case "json":
-            jsonData, err := json.MarshalIndent(pod, "", "    ")
-            if err != nil {
-                return err
-            }
-            fmt.Println(string(jsonData))
-        case "yaml":
-            yamlData, err := yaml.Marshal(pod)
-            if err != nil {
-                return err
-            }
-            fmt.Println(string(yamlData))
-        case "", "wide":
-            readyCount, totalCount :=
-                countReadyContainers(pod.Status.ContainerStatuses)
-            age := time.Since(pod.ObjectMeta.CreationTimestamp.Time).Round(
-                time.Second,
-            )
-            row := metav1.TableRow{
-                Cells: []interface{}{
-                    pod.Name,
-                    fmt.Sprintf("%d/%d", readyCount, totalCount),
-                    string(pod.Status.Phase),
-                    fmt.Sprintf(
-                        "%d",
-                        pod.Status.ContainerStatuses[0].RestartCount,
-                    ),
-                    age,
-                },
-            }
-            if (output == "wide") {
-                nominatedNode := "<none>"
-                if pod.Status.NominatedNodeName != "" {
-                    nominatedNode = pod.Status.NominatedNodeName
-                }
-                var readinessGates []string
-                ready := false
-                for _, condition := range pod.Status.Conditions {
-                    if condition.Type == v1.PodReady &&
-                            condition.Status == v1.ConditionTrue {
-                        ready = true
-                        break
-                    }
-                    readinessGates = append(
-                        readinessGates,
-                        string(condition.Type),
-                    )
-                }
-                var readinessGatesStr string
-                if ready || len(readinessGates) == 0 {
-                    readinessGatesStr = "<none>"
-                } else {
-                    readinessGatesStr = strings.Join(readinessGates, ", ")
-                }
-
-                row.Cells = append(
-                    row.Cells,
-                    pod.Status.PodIP,
-                    pod.Spec.NodeName,
-                    nominatedNode,
-                    readinessGatesStr,
-                )
-            }
+// getPrinter returns the printer for the requested output format, wrapped
+// in a sorting printer if --sort-by was given.
+func getPrinter(printFlags *get.PrintFlags) (printers.ResourcePrinter, error) {
+    printer, err := printFlags.ToPrinter()
+    if err != nil {
+        return nil, err
+    }
+    if *printFlags.OutputFormat == "name" {
+        printer = &listItemPrinter{delegate: printer}
+    }
 
-            table.Rows = append(table.Rows, row)
+    sortBy := ""
+    if printFlags.HumanReadableFlags.SortBy != nil {
+        sortBy = *printFlags.HumanReadableFlags.SortBy
+    }
+    if sortBy != "" {
+        printer = &get.SortingPrinter{
+            Delegate:  printer,
+            SortField: sortBy,
+            Decoder:   scheme.Codecs.UniversalDecoder(),
         }
     }
+    return printer, nil
+}
 
-    if output == "" || output == "wide" {
-        err = printer.PrintObj(&table, os.Stdout)
+// isHumanOutput reports whether the flags select the table printer rather
+// than one of the machine-readable formats.
+func isHumanOutput(printFlags *get.PrintFlags) bool {
+    if printFlags.TemplateFlags.TemplateArgument != nil &&
+            *printFlags.TemplateFlags.TemplateArgument != "" {
+        return false
+    }
+    output := *printFlags.OutputFormat
+    return output == "" || output == "wide"
+}
+
+// listItemPrinter hands each item of a list to its delegate. The name
+// printer refuses lists, so like 'kubectl get' we print one pod at a time.
+// Anything else, like a pod from a watch, goes to the delegate as it is.
+type listItemPrinter struct {
+    delegate printers.ResourcePrinter
+}
+
+func (p *listItemPrinter) PrintObj(obj runtime.Object, out io.Writer) error {
+    if !meta.IsListType(obj) {
+        return p.delegate.PrintObj(obj, out)
+    }
+    items, err := meta.ExtractList(obj)
+    if err != nil {
         return err
     }
+    for _, item := range items {
+        if err := p.delegate.PrintObj(item, out); err != nil {
+            return err
+        }
+    }
     return nil
 }
+
+// podsToList wraps pods in a v1 List the same way 'kubectl get' does, so the
+// result round-trips through 'kubectl apply -f -'.
+func podsToList(pods []v1.Pod) *v1.List {
+    list := &v1.List{
+        TypeMeta: metav1.TypeMeta{Kind: "List", APIVersion: "v1"},
+        Items:    []runtime.RawExtension{},
+    }
+    for i := range pods {
+        pod := &pods[i]
+        pod.SetGroupVersionKind(v1.SchemeGroupVersion.WithKind("Pod"))
+        list.Items = append(list.Items, runtime.RawExtension{Object: pod})
+    }
+    return list
+}
+
+// podsToTable builds the same table 'kubectl get pods' shows. Columns with a
+// non-zero priority are only shown with -o wide.
+func podsToTable(pods []v1.Pod) *metav1.Table {
+    table := &metav1.Table{
+        ColumnDefinitions: []metav1.TableColumnDefinition{
+            {Name: "NAME", Type: "string"},
+            {Name: "READY", Type: "string"},
+            {Name: "STATUS", Type: "string"},
+            {Name: "RESTARTS", Type: "string"},
+            {Name: "AGE", Type: "string"},
+            {Name: "IP", Type: "string", Priority: 1},
+            {Name: "NODE", Type: "string", Priority: 1},
+            {Name: "NOMINATED NODE", Type: "string", Priority: 1},
+            {Name: "READINESS GATES", Type: "string", Priority: 1},
+            {Name: "INIT", Type: "string", Priority: 1},
+            {Name: "REVISION", Type: "string", Priority: 1},
+        },
+    }
+
+    for i := range pods {
+        table.Rows = append(table.Rows, podToRow(&pods[i]))
+    }
+    return table
+}
+
+func podToRow(pod *v1.Pod) metav1.TableRow {
+    summary := summarizePod(pod)
+
+    podIP := ""
+    if len(pod.Status.PodIPs) > 0 {
+        podIP = pod.Status.PodIPs[0].IP
+    }
+
+    return metav1.TableRow{
+        Cells: []interface{}{
+            pod.Name,
+            fmt.Sprintf("%d/%d", summary.ready, summary.total),
+            summary.status,
+            summary.restartsString(),
+            translateTimestampSince(pod.CreationTimestamp),
+            orNone(podIP),
+            orNone(pod.Spec.NodeName),
+            orNone(pod.Status.NominatedNodeName),
+            readinessGatesString(pod),
+            summary.initString(),
+            orNone(pod.Labels[appsv1.DefaultDaemonSetUniqueLabelKey]),
+        },
+        Object: runtime.RawExtension{Object: pod},
+    }
+}
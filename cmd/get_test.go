@@ -0,0 +1,73 @@
+package cmd
+
+import (
+    "bytes"
+    "testing"
+
+    v1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/types"
+    "k8s.io/apimachinery/pkg/watch"
+    "k8s.io/cli-runtime/pkg/printers"
+    "k8s.io/kubectl/pkg/cmd/get"
+)
+
+func testNamePrinter(t *testing.T) (*get.PrintFlags, printers.ResourcePrinter) {
+    printFlags := get.NewGetPrintFlags()
+    output := "name"
+    printFlags.OutputFormat = &output
+    printer, err := getPrinter(printFlags)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return printFlags, printer
+}
+
+func testPod(name string) v1.Pod {
+    return v1.Pod{
+        ObjectMeta: metav1.ObjectMeta{
+            Name: name, Namespace: "default", UID: types.UID(name),
+        },
+    }
+}
+
+func TestGetOutputName(t *testing.T) {
+    _, printer := testNamePrinter(t)
+    var out bytes.Buffer
+    pods := []v1.Pod{testPod("agent-a"), testPod("agent-b")}
+    if err := printer.PrintObj(podsToList(pods), &out); err != nil {
+        t.Fatal(err)
+    }
+    want := "pod/agent-a\npod/agent-b\n"
+    if out.String() != want {
+        t.Errorf("got %q, want %q", out.String(), want)
+    }
+}
+
+func TestWatchOutputName(t *testing.T) {
+    printFlags, printer := testNamePrinter(t)
+    var buf bytes.Buffer
+    out := printers.GetNewTabWriter(&buf)
+    known := make(map[types.UID]*v1.Pod)
+
+    for _, step := range []struct {
+        eventType watch.EventType
+        pod       v1.Pod
+    }{
+        {watch.Added, testPod("agent-a")},
+        {watch.Added, testPod("agent-b")},
+        {watch.Deleted, testPod("agent-a")},
+    } {
+        pod := step.pod
+        err := printWatchEvent(
+            out, printer, printFlags, known, step.eventType, &pod, false,
+        )
+        if err != nil {
+            t.Fatal(err)
+        }
+    }
+    want := "pod/agent-a\npod/agent-b\npod/agent-a\n"
+    if buf.String() != want {
+        t.Errorf("got %q, want %q", buf.String(), want)
+    }
+}
@@ -23,6 +23,7 @@ func newDshListCommand(
         Long:
 `Will list alll daemonsets on a node. You can pass in the node as the arg, or
 use -N.`,
+        Annotations: map[string]string{nodeArgAnnotation: "true"},
         Args: cobra.MatchAll(cobra.MaximumNArgs(1)),
         RunE: func(cmd *cobra.Command, args []string) error {
             if len(args) == 1 {
@@ -30,6 +30,7 @@ func newDshLogCommand(
 allowed.  If only a node is specified logs from all pods owned by a daemonset
 on that node will be shown. If only a daemonset is specified, all pods in that
 daemonset will have their logs shown.`,
+        Annotations: map[string]string{daemonSetArgAnnotation: "true"},
         Args: cobra.MatchAll(cobra.ExactArgs(1)),
         RunE: func(cmd *cobra.Command, args []string) error {
             return dshLog.getLogs(
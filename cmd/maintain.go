@@ -0,0 +1,385 @@
+package cmd
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "github.com/spf13/cobra"
+    "io"
+    "os"
+    "time"
+
+    appsv1 "k8s.io/api/apps/v1"
+    v1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/types"
+    "k8s.io/client-go/kubernetes"
+    corev1helpers "k8s.io/component-helpers/scheduling/corev1"
+    "k8s.io/component-helpers/scheduling/corev1/nodeaffinity"
+    "k8s.io/klog/v2"
+    "k8s.io/kubectl/pkg/drain"
+)
+
+// The node annotation where maintain keeps track of how far along it is
+const maintenanceAnnotation = "kubectl-daemons/maintenance"
+
+// The phases of maintain, in order
+var maintenancePhases = []string{"prepare", "restart-daemons", "finish"}
+
+// maintenanceState is what's in the maintenance annotation.
+type maintenanceState struct {
+    // The last phase that completed
+    Phase     string    `json:"phase"`
+    Completed time.Time `json:"completed"`
+    // Whether the node was already cordoned before prepare, in which case
+    // finish leaves it that way
+    WasUnschedulable bool `json:"wasUnschedulable"`
+}
+
+// maintainOptions are the flags of maintain
+type maintainOptions struct {
+    allNamespaces      bool
+    force              bool
+    deleteEmptyDirData bool
+    gracePeriod        int
+    timeout            time.Duration
+}
+
+func newDshMaintainCommand(
+    out io.Writer, context *string, namespace *string, nodeName *string,
+    config *dshConfig,
+) *cobra.Command {
+    var opts maintainOptions
+
+    dshMaintain := &dshCmd{
+        out:    out,
+        config: config,
+    }
+
+    cmd := &cobra.Command{
+        Use:   "maintain [prepare|restart-daemons|finish] -N <node> [<options>]",
+        Short: "take a node through maintenance",
+        Long:
+`Takes a node through maintenance, in phases:
+
+  prepare          cordons the node and drains everything but daemonset and
+                   mirror pods, evicting them so PodDisruptionBudgets are
+                   respected
+  restart-daemons  restarts the node's daemonset pods one at a time, like
+                   restart-node, so in dependency order, and otherwise in
+                   the order of maintain.restartOrder in the config file
+                   (e.g. the CNI first)
+  finish           waits for every daemonset that should be on the node to
+                   have a ready pod there, then uncordons it (unless it was
+                   already cordoned before prepare)
+
+How far the node got is kept in its kubectl-daemons/maintenance annotation,
+so without a phase, maintain runs the next one, and a phase that failed can
+simply be run again. Typically you'd prepare, reboot or patch the node, and
+then run restart-daemons and finish.
+
+Daemonsets in every namespace are handled, unless you give -n.`,
+        Annotations: map[string]string{allNamespacesAnnotation: "true"},
+        Args: cobra.MatchAll(
+            cobra.MaximumNArgs(1), cobra.OnlyValidArgs,
+        ),
+        ValidArgs: maintenancePhases,
+        RunE: func(cmd *cobra.Command, args []string) error {
+            phase := ""
+            if len(args) == 1 {
+                phase = args[0]
+            }
+            ns := *namespace
+            if !cmd.Flags().Changed("namespace") {
+                ns = ""
+            }
+            return dshMaintain.maintain(*context, ns, *nodeName, phase, opts)
+        },
+    }
+
+    cmd.Flags().BoolVar(
+        &opts.force, "force", false,
+        "Drain pods that no controller will recreate, too",
+    )
+    cmd.Flags().BoolVar(
+        &opts.deleteEmptyDirData, "delete-emptydir-data", false,
+        "Drain pods with emptyDir volumes, whose data will be lost",
+    )
+    cmd.Flags().IntVar(
+        &opts.gracePeriod, "grace-period", -1,
+        "Seconds drained pods get to shut down, -1 for their own default",
+    )
+    cmd.Flags().DurationVar(
+        &opts.timeout, "timeout", 10*time.Minute,
+        "How long to wait for the drain, and for each daemon to be ready",
+    )
+    return cmd
+}
+
+func (sv *dshCmd) maintain(
+    kcontext string, namespace string, nodeName string, phase string,
+    opts maintainOptions,
+) error {
+    if nodeName == "" {
+        return errors.New("-N is required")
+    }
+
+    clientset, _, err := getClientSet(kcontext)
+    if err != nil {
+        return err
+    }
+    if err := preflight(
+        clientset, namespace, permGetNodes, permPatchNodes, permListPods,
+        permEvict, permDeletePods,
+    ); err != nil {
+        return err
+    }
+
+    node, err := clientset.CoreV1().Nodes().Get(
+        context.TODO(), nodeName, metav1.GetOptions{},
+    )
+    if err != nil {
+        return err
+    }
+    state, err := getMaintenanceState(node)
+    if err != nil {
+        return err
+    }
+
+    next := 0
+    if state != nil {
+        next = phaseIndex(state.Phase) + 1
+    }
+    if phase == "" {
+        if next >= len(maintenancePhases) {
+            return fmt.Errorf("node %s isn't in maintenance", nodeName)
+        }
+        phase = maintenancePhases[next]
+    } else if phaseIndex(phase) > next {
+        return fmt.Errorf(
+            "node %s hasn't been through %s yet",
+            nodeName, maintenancePhases[next],
+        )
+    }
+    if state == nil {
+        state = &maintenanceState{WasUnschedulable: node.Spec.Unschedulable}
+    }
+
+    fmt.Fprintf(sv.out, "Node %s: %s\n", nodeName, phase)
+    switch phase {
+    case "prepare":
+        err = sv.prepareNode(clientset, node, opts)
+    case "restart-daemons":
+        err = sv.restartNodeDaemons(
+            clientset, namespace, nodeName, opts.timeout, false,
+        )
+    case "finish":
+        err = sv.finishNode(clientset, namespace, node, state, opts.timeout)
+        if err == nil {
+            return setMaintenanceState(clientset, nodeName, nil)
+        }
+    }
+    if err != nil {
+        return fmt.Errorf("%s failed, fix that and run it again: %w", phase, err)
+    }
+
+    state.Phase = phase
+    state.Completed = time.Now().UTC().Truncate(time.Second)
+    return setMaintenanceState(clientset, nodeName, state)
+}
+
+func phaseIndex(phase string) int {
+    for i, p := range maintenancePhases {
+        if p == phase {
+            return i
+        }
+    }
+    return -1
+}
+
+func getMaintenanceState(node *v1.Node) (*maintenanceState, error) {
+    value, ok := node.Annotations[maintenanceAnnotation]
+    if !ok {
+        return nil, nil
+    }
+    state := &maintenanceState{}
+    if err := json.Unmarshal([]byte(value), state); err != nil {
+        return nil, fmt.Errorf(
+            "bad %s annotation on node %s: %w",
+            maintenanceAnnotation, node.Name, err,
+        )
+    }
+    if phaseIndex(state.Phase) == -1 {
+        return nil, fmt.Errorf(
+            "unknown phase %q in %s annotation on node %s",
+            state.Phase, maintenanceAnnotation, node.Name,
+        )
+    }
+    return state, nil
+}
+
+// setMaintenanceState saves state in the annotation on the node, or with no
+// state, removes it.
+func setMaintenanceState(
+    clientset *kubernetes.Clientset, nodeName string, state *maintenanceState,
+) error {
+    var value interface{}
+    if state != nil {
+        data, err := json.Marshal(state)
+        if err != nil {
+            return err
+        }
+        value = string(data)
+    }
+    patch, err := json.Marshal(map[string]interface{}{
+        "metadata": map[string]interface{}{
+            "annotations": map[string]interface{}{
+                maintenanceAnnotation: value,
+            },
+        },
+    })
+    if err != nil {
+        return err
+    }
+    _, err = clientset.CoreV1().Nodes().Patch(
+        context.TODO(), nodeName, types.MergePatchType, patch,
+        metav1.PatchOptions{},
+    )
+    return err
+}
+
+func (sv *dshCmd) drainHelper(
+    clientset *kubernetes.Clientset, opts maintainOptions,
+) *drain.Helper {
+    return &drain.Helper{
+        Ctx:                 context.TODO(),
+        Client:              clientset,
+        Force:               opts.force,
+        GracePeriodSeconds:  opts.gracePeriod,
+        IgnoreAllDaemonSets: true,
+        DeleteEmptyDirData:  opts.deleteEmptyDirData,
+        Timeout:             opts.timeout,
+        Out:                 sv.out,
+        ErrOut:              os.Stderr,
+        OnPodDeletionOrEvictionFinished: func(
+            pod *v1.Pod, usingEviction bool, err error,
+        ) {
+            action, verb := "delete", "deleted"
+            if usingEviction {
+                action, verb = "evict", "evicted"
+            }
+            auditPod(action, pod, err)
+            if err == nil {
+                fmt.Fprintf(sv.out, "pod \"%s\" %s\n", pod.Name, verb)
+            }
+        },
+    }
+}
+
+// prepareNode cordons and drains node, leaving the daemons alone.
+func (sv *dshCmd) prepareNode(
+    clientset *kubernetes.Clientset, node *v1.Node, opts maintainOptions,
+) error {
+    helper := sv.drainHelper(clientset, opts)
+    err := drain.RunCordonOrUncordon(helper, node, true)
+    auditNode("cordon", node.Name, err)
+    if err != nil {
+        return err
+    }
+    fmt.Fprintf(sv.out, "node \"%s\" cordoned\n", node.Name)
+    err = drain.RunNodeDrain(helper, node.Name)
+    auditNode("drain", node.Name, err)
+    if err != nil {
+        return err
+    }
+    fmt.Fprintf(sv.out, "node \"%s\" drained\n", node.Name)
+    return nil
+}
+
+// finishNode waits for every daemonset that belongs on node to be ready
+// there, then uncordons it, unless it was cordoned to begin with.
+func (sv *dshCmd) finishNode(
+    clientset *kubernetes.Clientset, namespace string, node *v1.Node,
+    state *maintenanceState, timeout time.Duration,
+) error {
+    dsList, err := clientset.AppsV1().DaemonSets(namespace).List(
+        context.TODO(), metav1.ListOptions{},
+    )
+    if err != nil {
+        return err
+    }
+    for i := range dsList.Items {
+        ds := &dsList.Items[i]
+        if !daemonSetEligible(ds, node) {
+            continue
+        }
+        pod, err := waitForReadyDaemonPod(
+            context.TODO(), clientset, ds.Name, ds.Namespace, node.Name, "",
+            timeout,
+        )
+        if err != nil {
+            return fmt.Errorf(
+                "no ready pod for %s/%s after %s: %w",
+                ds.Namespace, ds.Name, timeout, err,
+            )
+        }
+        fmt.Fprintf(
+            sv.out, "%s/%s ready: pod \"%s\"\n",
+            ds.Namespace, ds.Name, pod.Name,
+        )
+    }
+
+    if state.WasUnschedulable {
+        fmt.Fprintf(
+            sv.out, "Leaving node %s cordoned, as it was before prepare\n",
+            node.Name,
+        )
+        return nil
+    }
+    helper := sv.drainHelper(clientset, maintainOptions{})
+    err = drain.RunCordonOrUncordon(helper, node, false)
+    auditNode("uncordon", node.Name, err)
+    if err != nil {
+        return err
+    }
+    fmt.Fprintf(sv.out, "node \"%s\" uncordoned\n", node.Name)
+    return nil
+}
+
+// The taints the daemonset controller tolerates for every daemonset. It
+// only tolerates v1.TaintNodeNetworkUnavailable for those on the host
+// network.
+var daemonSetTaintKeys = map[string]bool{
+    v1.TaintNodeNotReady:       true,
+    v1.TaintNodeUnreachable:    true,
+    v1.TaintNodeDiskPressure:   true,
+    v1.TaintNodeMemoryPressure: true,
+    v1.TaintNodePIDPressure:    true,
+    v1.TaintNodeUnschedulable:  true,
+}
+
+// daemonSetEligible says whether ds should have a pod on node: the node
+// matches its node selector and affinity, and it tolerates the node's
+// taints.
+func daemonSetEligible(ds *appsv1.DaemonSet, node *v1.Node) bool {
+    pod := &v1.Pod{Spec: ds.Spec.Template.Spec}
+    match, err := nodeaffinity.GetRequiredNodeAffinity(pod).Match(node)
+    if err != nil || !match {
+        return false
+    }
+    _, untolerated := corev1helpers.FindMatchingUntoleratedTaint(
+        klog.Background(), node.Spec.Taints, pod.Spec.Tolerations,
+        func(t *v1.Taint) bool {
+            if t.Key == v1.TaintNodeNetworkUnavailable &&
+                pod.Spec.HostNetwork {
+                return false
+            }
+            return !daemonSetTaintKeys[t.Key] && (
+                t.Effect == v1.TaintEffectNoSchedule ||
+                t.Effect == v1.TaintEffectNoExecute)
+        },
+        false,
+    )
+    return !untolerated
+}
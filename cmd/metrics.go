@@ -0,0 +1,114 @@
+package cmd
+
+import (
+    "bufio"
+    "bytes"
+    "fmt"
+    "math"
+    "sort"
+    "strconv"
+    "strings"
+)
+
+// How many (scaled) median absolute deviations a value has to be from the
+// median to be an outlier
+const outlierThreshold = 3.5
+
+// parseMetrics parses the Prometheus text exposition format into a map of
+// series, as written, e.g. 'requests_total{code="200"}', to value. Comments,
+// and with them the TYPE and HELP lines, are skipped, and so are timestamps.
+func parseMetrics(data []byte) (map[string]float64, error) {
+    series := make(map[string]float64)
+    scanner := bufio.NewScanner(bytes.NewReader(data))
+    scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+    line := 0
+    for scanner.Scan() {
+        line++
+        text := strings.TrimSpace(scanner.Text())
+        if text == "" || strings.HasPrefix(text, "#") {
+            continue
+        }
+        name, rest, err := splitSeries(text)
+        if err != nil {
+            return nil, fmt.Errorf("line %d: %w", line, err)
+        }
+        fields := strings.Fields(rest)
+        if len(fields) == 0 || len(fields) > 2 {
+            return nil, fmt.Errorf("line %d: no value for %s", line, name)
+        }
+        value, err := strconv.ParseFloat(fields[0], 64)
+        if err != nil {
+            return nil, fmt.Errorf("line %d: %w", line, err)
+        }
+        series[name] = value
+    }
+    return series, scanner.Err()
+}
+
+// splitSeries splits a sample line into the series, with its labels, and
+// what comes after it. Label values are quoted and can have anything in them,
+// including spaces, braces and escaped quotes.
+func splitSeries(text string) (string, string, error) {
+    brace := strings.IndexAny(text, "{ \t")
+    if brace == -1 {
+        return "", "", fmt.Errorf("no value in %q", text)
+    }
+    if text[brace] != '{' {
+        return text[:brace], text[brace:], nil
+    }
+    inQuotes := false
+    for i := brace + 1; i < len(text); i++ {
+        switch {
+        case inQuotes && text[i] == '\\':
+            i++
+        case text[i] == '"':
+            inQuotes = !inQuotes
+        case !inQuotes && text[i] == '}':
+            return text[:i+1], text[i+1:], nil
+        }
+    }
+    return "", "", fmt.Errorf("unterminated labels in %q", text)
+}
+
+// outliers returns which of values are far from the rest, by the median
+// absolute deviation, which a single crazy node can't throw off the way it
+// can a mean. The result is -1 for low, 1 for high and 0 for neither.
+func outliers(values []float64) []int {
+    result := make([]int, len(values))
+    if len(values) < 3 {
+        return result
+    }
+    center := median(values)
+    deviations := make([]float64, len(values))
+    for i, value := range values {
+        deviations[i] = math.Abs(value - center)
+    }
+    // scaled so it's comparable to a standard deviation
+    mad := 1.4826 * median(deviations)
+    for i, value := range values {
+        var far bool
+        if mad == 0 {
+            // most nodes agree exactly, so anything else stands out
+            far = value != center
+        } else {
+            far = math.Abs(value-center)/mad > outlierThreshold
+        }
+        switch {
+        case far && value > center:
+            result[i] = 1
+        case far:
+            result[i] = -1
+        }
+    }
+    return result
+}
+
+func median(values []float64) float64 {
+    sorted := append([]float64{}, values...)
+    sort.Float64s(sorted)
+    middle := len(sorted) / 2
+    if len(sorted)%2 == 1 {
+        return sorted[middle]
+    }
+    return (sorted[middle-1] + sorted[middle]) / 2
+}
@@ -0,0 +1,171 @@
+package cmd
+
+import (
+    "math"
+    "reflect"
+    "testing"
+)
+
+func TestParseMetrics(t *testing.T) {
+    tests := []struct {
+        name    string
+        data    string
+        want    map[string]float64
+        wantErr bool
+    }{
+        {
+            name: "comments and plain series",
+            data: "# HELP up Whether it's up\n# TYPE up gauge\nup 1\n\n",
+            want: map[string]float64{"up": 1},
+        },
+        {
+            name: "labels",
+            data: `requests_total{code="200",method="GET"} 1027` + "\n",
+            want: map[string]float64{
+                `requests_total{code="200",method="GET"}`: 1027,
+            },
+        },
+        {
+            name: "escaped quotes in a label value",
+            data: `msg_total{text="say \"hi\""} 3` + "\n",
+            want: map[string]float64{`msg_total{text="say \"hi\""}`: 3},
+        },
+        {
+            name: "commas, braces and spaces in a label value",
+            data: `odd{a="x, y",b="{z} }",c="1 2"} 4` + "\n",
+            want: map[string]float64{`odd{a="x, y",b="{z} }",c="1 2"}`: 4},
+        },
+        {
+            name: "escaped backslash before the closing quote",
+            data: `path{dir="C:\\"} 5` + "\n",
+            want: map[string]float64{`path{dir="C:\\"}`: 5},
+        },
+        {
+            name: "trailing timestamps",
+            data: "up 1 1714567890000\n" +
+                `requests_total{code="500"} 2 1714567890000` + "\n",
+            want: map[string]float64{
+                "up": 1, `requests_total{code="500"}`: 2,
+            },
+        },
+        {
+            name: "infinities",
+            data: "a +Inf\nb -Inf\n",
+            want: map[string]float64{"a": math.Inf(1), "b": math.Inf(-1)},
+        },
+        {
+            name: "scientific notation",
+            data: "latency_seconds 1.5e-3\n",
+            want: map[string]float64{"latency_seconds": 0.0015},
+        },
+        {
+            name:    "no value",
+            data:    "up\n",
+            wantErr: true,
+        },
+        {
+            name:    "too many fields",
+            data:    "up 1 2 3\n",
+            wantErr: true,
+        },
+        {
+            name:    "bad value",
+            data:    "up one\n",
+            wantErr: true,
+        },
+        {
+            name:    "unterminated labels",
+            data:    `up{a="b" 1` + "\n",
+            wantErr: true,
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got, err := parseMetrics([]byte(tt.data))
+            if tt.wantErr {
+                if err == nil {
+                    t.Fatalf("expected an error, got %v", got)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatal(err)
+            }
+            if !reflect.DeepEqual(got, tt.want) {
+                t.Errorf("got %v, want %v", got, tt.want)
+            }
+        })
+    }
+}
+
+// NaN isn't equal to itself, so it can't go through DeepEqual with the rest.
+func TestParseMetricsNaN(t *testing.T) {
+    got, err := parseMetrics([]byte("ratio NaN\nratio_ts NaN 1714567890000\n"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    for _, name := range []string{"ratio", "ratio_ts"} {
+        if value, ok := got[name]; !ok || !math.IsNaN(value) {
+            t.Errorf("%s: got %v, %v, want NaN", name, value, ok)
+        }
+    }
+}
+
+func TestOutliers(t *testing.T) {
+    tests := []struct {
+        name   string
+        values []float64
+        want   []int
+    }{
+        {
+            name:   "none",
+            values: nil,
+            want:   []int{},
+        },
+        {
+            name:   "fewer than three pods",
+            values: []float64{1, 1000},
+            want:   []int{0, 0},
+        },
+        {
+            name:   "all equal",
+            values: []float64{7, 7, 7, 7},
+            want:   []int{0, 0, 0, 0},
+        },
+        {
+            name:   "all but one equal",
+            values: []float64{7, 7, 9, 7, 7},
+            want:   []int{0, 0, 1, 0, 0},
+        },
+        {
+            name:   "all but one equal, low",
+            values: []float64{7, 7, 7, 0},
+            want:   []int{0, 0, 0, -1},
+        },
+        {
+            name:   "spread out, no outliers",
+            values: []float64{10, 12, 11, 13, 9},
+            want:   []int{0, 0, 0, 0, 0},
+        },
+        {
+            name:   "one high",
+            values: []float64{10, 12, 11, 13, 9, 400},
+            want:   []int{0, 0, 0, 0, 0, 1},
+        },
+        {
+            name:   "one low",
+            values: []float64{100, 102, 98, 101, 99, 3},
+            want:   []int{0, 0, 0, 0, 0, -1},
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got := outliers(tt.values)
+            if !reflect.DeepEqual(got, tt.want) {
+                t.Errorf("outliers(%v) = %v, want %v", tt.values, got, tt.want)
+            }
+        })
+    }
+}
@@ -0,0 +1,231 @@
+package cmd
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "github.com/spf13/cobra"
+    "io"
+    "os"
+    "os/signal"
+    "syscall"
+    "time"
+
+    v1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/client-go/kubernetes"
+)
+
+// The name of the container in node-shell pods
+const nodeShellContainer = "shell"
+
+func newDshNodeShellCommand(
+    out io.Writer, context *string, namespace *string, nodeName *string,
+) *cobra.Command {
+    var image string
+    var timeout time.Duration
+
+    dshNodeShell := &dshCmd{
+        out: out,
+    }
+
+    cmd := &cobra.Command{
+        Use:   "node-shell [<daemonset>] -N <node> [<options>] [-- <command> [args...]]",
+        Short: "get a root shell on a node",
+        Long:
+`Starts a privileged pod on the specified node that enters the namespaces of
+the host's init process, and attaches to it, so you get a root shell on the
+host itself. The pod is deleted when the shell exits or is interrupted.
+
+With a daemonset, the pod gets the daemonset's tolerations, so it runs
+anywhere the daemon does. Without one, it tolerates everything.
+
+The default shell is 'sh -l'. To run something else, pass it after '--':
+
+kubectl d node-shell -N my-node -- journalctl -u kubelet -f`,
+        Annotations: map[string]string{daemonSetArgAnnotation: "true"},
+        Args: cobra.MatchAll(argsBeforeDash(cobra.MaximumNArgs(1))),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            var ds string
+            var command []string
+            if dash := cmd.ArgsLenAtDash(); dash != -1 {
+                command = args[dash:]
+                args = args[:dash]
+            }
+            if len(args) == 1 {
+                ds = args[0]
+            }
+            return dshNodeShell.nodeShell(
+                *context, *namespace, ds, *nodeName, image, command, timeout,
+            )
+        },
+    }
+
+    cmd.Flags().StringVar(
+        &image, "image", "busybox",
+        "The image for the shell pod, which needs nsenter",
+    )
+    cmd.Flags().DurationVar(
+        &timeout, "timeout", 2*time.Minute,
+        "How long to wait for the shell pod to start",
+    )
+    return cmd
+}
+
+func (sv *dshCmd) nodeShell(
+    kcontext string, namespace string, ds string, nodeName string,
+    image string, command []string, timeout time.Duration,
+) error {
+    if nodeName == "" {
+        return errors.New("-N is required")
+    }
+
+    clientset, config, err := getClientSet(kcontext)
+    if err != nil {
+        return err
+    }
+    err = preflight(
+        clientset, namespace, permCreatePods, permAttach, permDeletePods,
+    )
+    if err != nil {
+        return err
+    }
+
+    tolerations := []v1.Toleration{{Operator: v1.TolerationOpExists}}
+    if ds != "" {
+        daemonSet, err := clientset.AppsV1().DaemonSets(namespace).Get(
+            context.TODO(), ds, metav1.GetOptions{},
+        )
+        if err != nil {
+            return err
+        }
+        tolerations = daemonSet.Spec.Template.Spec.Tolerations
+    }
+
+    if len(command) == 0 {
+        command = []string{"sh", "-l"}
+    }
+    pod, err := clientset.CoreV1().Pods(namespace).Create(
+        context.TODO(),
+        nodeShellPod(nodeName, image, tolerations, command),
+        metav1.CreateOptions{},
+    )
+    if err != nil {
+        return err
+    }
+
+    // in raw mode ^C goes to the shell, but until then, or if we're killed,
+    // we stop, and still clean up after ourselves on the way out
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+    signals := make(chan os.Signal, 1)
+    signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+    defer signal.Stop(signals)
+    go func() {
+        select {
+        case <-signals:
+            cancel()
+        case <-ctx.Done():
+        }
+    }()
+    defer deleteNodeShellPod(clientset, pod)
+
+    fmt.Fprintf(
+        sv.out, "Waiting for pod %s on node %s to start...\n",
+        pod.Name, nodeName,
+    )
+    err = waitForContainer(ctx, clientset, pod, nodeShellContainer, timeout)
+    if ctx.Err() != nil {
+        return errors.New("interrupted")
+    }
+    if err != nil {
+        return err
+    }
+
+    streamOptions, restore, err := ttyStreamOptions()
+    if err != nil {
+        return err
+    }
+    defer restore()
+
+    fmt.Fprintf(
+        os.Stderr, "If you don't see a command prompt, try pressing enter.\r\n",
+    )
+    err = streamAttach(
+        ctx, clientset, config, namespace, pod.Name, nodeShellContainer,
+        streamOptions,
+    )
+    if ctx.Err() != nil {
+        err = errors.New("interrupted")
+    }
+    auditNode("node-shell", nodeName, err)
+    return err
+}
+
+// nodeShellPod is a pod that runs command in the namespaces of pid 1 on
+// nodeName, which is as good as running it on the host.
+func nodeShellPod(
+    nodeName string, image string, tolerations []v1.Toleration,
+    command []string,
+) *v1.Pod {
+    privileged := true
+    gracePeriod := int64(0)
+    return &v1.Pod{
+        ObjectMeta: metav1.ObjectMeta{
+            GenerateName: "node-shell-",
+            Labels: map[string]string{
+                "app.kubernetes.io/managed-by": "kubectl-daemons",
+            },
+        },
+        Spec: v1.PodSpec{
+            NodeName:                      nodeName,
+            HostPID:                       true,
+            HostNetwork:                   true,
+            HostIPC:                       true,
+            Tolerations:                   tolerations,
+            RestartPolicy:                 v1.RestartPolicyNever,
+            TerminationGracePeriodSeconds: &gracePeriod,
+            Containers: []v1.Container{{
+                Name:  nodeShellContainer,
+                Image: image,
+                Command: append(
+                    []string{
+                        "nsenter", "--target", "1", "--mount", "--uts",
+                        "--ipc", "--net", "--pid", "--",
+                    },
+                    command...,
+                ),
+                Stdin: true,
+                TTY:   true,
+                SecurityContext: &v1.SecurityContext{
+                    Privileged: &privileged,
+                },
+            }},
+        },
+    }
+}
+
+func deleteNodeShellPod(clientset *kubernetes.Clientset, pod *v1.Pod) {
+    gracePeriod := int64(0)
+    err := clientset.CoreV1().Pods(pod.Namespace).Delete(
+        context.TODO(), pod.Name,
+        metav1.DeleteOptions{GracePeriodSeconds: &gracePeriod},
+    )
+    if err != nil {
+        fmt.Fprintf(
+            os.Stderr, "Error deleting pod %s, please delete it yourself: %v\n",
+            pod.Name, err,
+        )
+    }
+}
+
+// argsBeforeDash applies validate to the args before any --, which are ours
+// rather than the command's.
+func argsBeforeDash(validate cobra.PositionalArgs) cobra.PositionalArgs {
+    return func(cmd *cobra.Command, args []string) error {
+        if dash := cmd.ArgsLenAtDash(); dash != -1 {
+            args = args[:dash]
+        }
+        return validate(cmd, args)
+    }
+}
@@ -0,0 +1,172 @@
+package cmd
+
+import (
+    "fmt"
+    "github.com/spf13/cobra"
+    "io"
+    "path"
+    "strings"
+)
+
+// The annotation on commands that work in every namespace unless given -n
+const allNamespacesAnnotation = "kubectl-daemons/all-namespaces"
+
+// policyGuard enforces the policy in the config file, and --read-only, on
+// the commands that change things, and keeps the audit log of them.
+type policyGuard struct {
+    out       io.Writer
+    config    *dshConfig
+    context   *string
+    namespace *string
+    readOnly  *bool
+}
+
+// mutating wraps cmd so the policy is checked before it runs, and what it
+// does is audited. With flags, cmd only changes things when one of them is
+// set, like stale-config --restart.
+func (g *policyGuard) mutating(
+    cmd *cobra.Command, flags ...string,
+) *cobra.Command {
+    run := cmd.RunE
+    cmd.RunE = func(c *cobra.Command, args []string) error {
+        if !changesThings(c, flags) {
+            return run(c, args)
+        }
+        namespace := g.targetNamespace(c)
+        err := g.check(c, args, namespace, &g.config.Policy)
+        if err != nil {
+            return err
+        }
+        audit := startAudit(*g.context, c, &g.config.Audit)
+        err = run(c, args)
+        audit.finish(
+            namespace, argDaemonSet(c, args), c.Flag("node").Value.String(),
+            c.CommandPath(), err,
+        )
+        return err
+    }
+    return cmd
+}
+
+// targetNamespace is the namespace c works in, "" being all of them.
+func (g *policyGuard) targetNamespace(c *cobra.Command) string {
+    if c.Annotations[allNamespacesAnnotation] == "true" &&
+        !c.Flags().Changed("namespace") {
+        return ""
+    }
+    return *g.namespace
+}
+
+// changesThings says whether c is about to change anything: it's not a dry
+// run, and if only some flags make it change things, one of them is set.
+func changesThings(c *cobra.Command, flags []string) bool {
+    if f := c.Flags().Lookup("dry-run"); f != nil {
+        switch f.Value.String() {
+        case "false", "none":
+        default:
+            return false
+        }
+    }
+    if len(flags) == 0 {
+        return true
+    }
+    for _, flag := range flags {
+        if c.Flags().Changed(flag) {
+            return true
+        }
+    }
+    return false
+}
+
+func (g *policyGuard) check(
+    c *cobra.Command, args []string, namespace string, policy *policyConfig,
+) error {
+    if *g.readOnly || policy.ReadOnly {
+        return fmt.Errorf(
+            "%s changes things, and read-only mode is on (--read-only or " +
+            "policy.readOnly in %s)", c.Name(), configPath(),
+        )
+    }
+
+    if c.Name() == "delete" && len(args) == 1 {
+        if err := policy.checkBulkDelete(
+            namespace, args[0], c.Flag("node").Value.String(),
+        ); err != nil {
+            return err
+        }
+    }
+
+    kcontext, _, err := getContextInfo(*g.context)
+    if err != nil {
+        return err
+    }
+    reason := policy.protection(kcontext, namespace)
+    if reason == "" {
+        return nil
+    }
+    if !isTerminal() {
+        return fmt.Errorf(
+            "%s, and there's no terminal to confirm running %s on",
+            reason, c.Name(),
+        )
+    }
+    ok, err := confirmTyped(
+        g.out, fmt.Sprintf(
+            "%s. To run %s anyway, type the context name", reason, c.Name(),
+        ), kcontext,
+    )
+    if err != nil {
+        return err
+    }
+    if !ok {
+        return fmt.Errorf("not running %s: %s", c.Name(), reason)
+    }
+    return nil
+}
+
+// protection says why kcontext and namespace ("" being all of them) are
+// protected, if they are.
+func (p *policyConfig) protection(kcontext string, namespace string) string {
+    if matchAny(p.Protected.Contexts, kcontext) {
+        return fmt.Sprintf("Context %s is protected", kcontext)
+    }
+    if namespace == "" && len(p.Protected.Namespaces) > 0 {
+        return fmt.Sprintf(
+            "This works in every namespace, including protected ones (%s)",
+            strings.Join(p.Protected.Namespaces, ", "),
+        )
+    }
+    if matchAny(p.Protected.Namespaces, namespace) {
+        return fmt.Sprintf("Namespace %s is protected", namespace)
+    }
+    return ""
+}
+
+// checkBulkDelete refuses deleting the pods of ds on every node at once, if
+// the policy says never to.
+func (p *policyConfig) checkBulkDelete(
+    namespace string, ds string, nodeName string,
+) error {
+    if nodeName != "" {
+        return nil
+    }
+    if matchAny(p.NeverBulkDelete, ds) ||
+        matchAny(p.NeverBulkDelete, namespace+"/"+ds) {
+        return fmt.Errorf(
+            "policy.neverBulkDelete says %s's pods may not all be deleted " +
+            "at once, do it a node at a time with -N", ds,
+        )
+    }
+    return nil
+}
+
+// matchAny says whether name matches any of patterns, which are shell
+// patterns like prod-*.
+func matchAny(patterns []string, name string) bool {
+    for _, pattern := range patterns {
+        if ok, _ := path.Match(pattern, name); ok {
+            return true
+        }
+    }
+    return false
+}
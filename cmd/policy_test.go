@@ -0,0 +1,231 @@
+package cmd
+
+import (
+    "io"
+    "os"
+    "strings"
+    "testing"
+
+    "github.com/spf13/cobra"
+)
+
+// testPolicyCommand is a command called name with our --node, and the
+// flags the commands that change things have.
+func testPolicyCommand(name string) *cobra.Command {
+    cmd := &cobra.Command{Use: name}
+    cmd.Flags().StringP("node", "N", "", "")
+    cmd.Flags().String("dry-run", "none", "")
+    cmd.Flags().Bool("restart", false, "")
+    cmd.Flags().StringP("namespace", "n", "", "")
+    return cmd
+}
+
+func TestChangesThings(t *testing.T) {
+    tests := []struct {
+        args  string
+        flags []string
+        want  bool
+    }{
+        {"", nil, true},
+        {"--dry-run=none", nil, true},
+        {"--dry-run=client", nil, false},
+        {"--dry-run=server", nil, false},
+        {"", []string{"restart"}, false},
+        {"--restart", []string{"restart"}, true},
+        {"--restart --dry-run=client", []string{"restart"}, false},
+    }
+    for _, tt := range tests {
+        cmd := testPolicyCommand("delete")
+        if err := cmd.ParseFlags(strings.Fields(tt.args)); err != nil {
+            t.Fatal(err)
+        }
+        if got := changesThings(cmd, tt.flags); got != tt.want {
+            t.Errorf(
+                "changesThings(%q, %q) = %v, want %v",
+                tt.args, tt.flags, got, tt.want,
+            )
+        }
+    }
+}
+
+func TestMatchAny(t *testing.T) {
+    patterns := []string{"prod-*", "kube-system", "infra/agent"}
+    tests := []struct {
+        name string
+        want bool
+    }{
+        {"prod-east", true},
+        {"prod", false},
+        {"kube-system", true},
+        {"kube-system-2", false},
+        {"infra/agent", true},
+        {"agent", false},
+        {"", false},
+    }
+    for _, tt := range tests {
+        if got := matchAny(patterns, tt.name); got != tt.want {
+            t.Errorf("matchAny(%q) = %v, want %v", tt.name, got, tt.want)
+        }
+    }
+}
+
+func TestProtection(t *testing.T) {
+    policy := &policyConfig{Protected: protectedConfig{
+        Contexts:   []string{"prod-*"},
+        Namespaces: []string{"kube-*", "infra"},
+    }}
+    tests := []struct {
+        kcontext  string
+        namespace string
+        want      string
+    }{
+        {"prod-east", "default", "Context prod-east is protected"},
+        {"dev", "default", ""},
+        {"dev", "infra", "Namespace infra is protected"},
+        {"dev", "kube-system", "Namespace kube-system is protected"},
+        {
+            "dev", "",
+            "This works in every namespace, including protected ones " +
+                "(kube-*, infra)",
+        },
+    }
+    for _, tt := range tests {
+        got := policy.protection(tt.kcontext, tt.namespace)
+        if got != tt.want {
+            t.Errorf(
+                "protection(%q, %q) = %q, want %q",
+                tt.kcontext, tt.namespace, got, tt.want,
+            )
+        }
+    }
+
+    var none policyConfig
+    if got := none.protection("prod", ""); got != "" {
+        t.Errorf("got %q with nothing protected, want nothing", got)
+    }
+}
+
+func TestCheckBulkDelete(t *testing.T) {
+    policy := &policyConfig{
+        NeverBulkDelete: []string{"cni", "infra/agent*"},
+    }
+    tests := []struct {
+        namespace string
+        ds        string
+        nodeName  string
+        wantErr   bool
+    }{
+        {"kube-system", "cni", "", true},
+        {"kube-system", "cni", "n1", false},
+        {"infra", "agent-v2", "", true},
+        {"monitoring", "agent", "", false},
+        {"infra", "proxy", "", false},
+    }
+    for _, tt := range tests {
+        err := policy.checkBulkDelete(tt.namespace, tt.ds, tt.nodeName)
+        if (err != nil) != tt.wantErr {
+            t.Errorf(
+                "checkBulkDelete(%q, %q, %q) = %v, want error %v",
+                tt.namespace, tt.ds, tt.nodeName, err, tt.wantErr,
+            )
+        }
+    }
+}
+
+func TestPolicyCheck(t *testing.T) {
+    testKubeconfig(t)
+    // without a terminal, protected places are refused rather than asked
+    // about
+    stdin := os.Stdin
+    devNull, err := os.Open(os.DevNull)
+    if err != nil {
+        t.Fatal(err)
+    }
+    os.Stdin = devNull
+    t.Cleanup(func() {
+        os.Stdin = stdin
+        devNull.Close()
+    })
+
+    policy := policyConfig{
+        Protected:       protectedConfig{Namespaces: []string{"kube-system"}},
+        NeverBulkDelete: []string{"cni"},
+    }
+    readOnly := policy
+    readOnly.ReadOnly = true
+
+    tests := []struct {
+        name      string
+        command   string
+        args      string
+        namespace string
+        readOnly  bool
+        policy    policyConfig
+        wantErr   string
+    }{
+        {
+            name: "allowed", command: "delete", args: "agent",
+            namespace: "infra", policy: policy,
+        },
+        {
+            name: "--read-only", command: "exec", args: "agent",
+            namespace: "infra", readOnly: true, policy: policy,
+            wantErr: "exec changes things, and read-only mode is on",
+        },
+        {
+            name: "policy.readOnly", command: "exec", args: "agent",
+            namespace: "infra", policy: readOnly,
+            wantErr: "exec changes things, and read-only mode is on",
+        },
+        {
+            name: "bulk delete", command: "delete", args: "cni",
+            namespace: "infra", policy: policy,
+            wantErr: "policy.neverBulkDelete says cni's pods may not all " +
+                "be deleted at once",
+        },
+        {
+            name: "delete on a node", command: "delete", args: "cni -N n1",
+            namespace: "infra", policy: policy,
+        },
+        {
+            name: "only delete is a bulk delete", command: "exec",
+            args: "cni", namespace: "infra", policy: policy,
+        },
+        {
+            name: "protected", command: "delete", args: "agent -N n1",
+            namespace: "kube-system", policy: policy,
+            wantErr: "Namespace kube-system is protected, and there's no " +
+                "terminal to confirm running delete on",
+        },
+        {
+            name: "every namespace", command: "restart-node", args: "",
+            namespace: "", policy: policy,
+            wantErr: "This works in every namespace, including protected " +
+                "ones (kube-system), and there's no terminal",
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            kcontext, namespace := "", tt.namespace
+            g := &policyGuard{
+                out:       io.Discard,
+                config:    &dshConfig{},
+                context:   &kcontext,
+                namespace: &namespace,
+                readOnly:  &tt.readOnly,
+            }
+            cmd := testPolicyCommand(tt.command)
+            if err := cmd.ParseFlags(strings.Fields(tt.args)); err != nil {
+                t.Fatal(err)
+            }
+            err := g.check(cmd, cmd.Flags().Args(), namespace, &tt.policy)
+            switch {
+            case tt.wantErr == "" && err != nil:
+                t.Errorf("got %v, want no error", err)
+            case tt.wantErr != "" &&
+                (err == nil || !strings.HasPrefix(err.Error(), tt.wantErr)):
+                t.Errorf("got %v, want %q", err, tt.wantErr)
+            }
+        })
+    }
+}
@@ -0,0 +1,258 @@
+package cmd
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "github.com/spf13/cobra"
+    "io"
+    "net/http"
+    "os"
+    "os/signal"
+    "strconv"
+    "strings"
+    "time"
+
+    appsv1 "k8s.io/api/apps/v1"
+    v1 "k8s.io/api/core/v1"
+    apierrors "k8s.io/apimachinery/pkg/api/errors"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/client-go/kubernetes"
+    "k8s.io/client-go/rest"
+    "k8s.io/client-go/tools/portforward"
+    "k8s.io/client-go/transport/spdy"
+)
+
+func newDshPortForwardCommand(
+    out io.Writer, context *string, namespace *string, nodeName *string,
+) *cobra.Command {
+    var addresses []string
+    var timeout time.Duration
+
+    dshPortForward := &dshCmd{
+        out: out,
+    }
+
+    cmd := &cobra.Command{
+        Use:   "port-forward <daemonset> -N <node> [LOCAL:]REMOTE [...[LOCAL:]REMOTE]",
+        Short: "forward local ports to the pod for <daemonset>",
+        Long:
+`Forwards local ports to the pod of the specified daemonset on the specified
+node, like 'kubectl port-forward'. REMOTE can be a port number or the name of
+a container port in the daemonset. Leave out LOCAL to use the same port
+locally, or use :REMOTE to pick a free one. For example:
+
+kubectl d port-forward my-daemonset -N my-node 6060 9090:metrics
+
+If the pod goes away, say because the daemonset rolled, the ports are
+forwarded to its replacement once it's ready.`,
+        Annotations: map[string]string{daemonSetArgAnnotation: "true"},
+        Args: cobra.MatchAll(cobra.MinimumNArgs(2)),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            return dshPortForward.portForward(
+                *context, *namespace, args[0], *nodeName, addresses, args[1:],
+                timeout,
+            )
+        },
+    }
+
+    cmd.Flags().StringSliceVar(
+        &addresses, "address", []string{"localhost"},
+        "Addresses to listen on (comma separated)",
+    )
+    cmd.Flags().DurationVar(
+        &timeout, "timeout", 5*time.Minute,
+        "How long to wait for a ready pod when (re)connecting",
+    )
+    return cmd
+}
+
+func (sv *dshCmd) portForward(
+    kcontext string, namespace string, ds string, nodeName string,
+    addresses []string, portArgs []string, timeout time.Duration,
+) error {
+    if nodeName == "" {
+        return errors.New("-N is required")
+    }
+
+    clientset, config, err := getClientSet(kcontext)
+    if err != nil {
+        return err
+    }
+
+    daemonSet, err := clientset.AppsV1().DaemonSets(namespace).Get(
+        context.TODO(), ds, metav1.GetOptions{},
+    )
+    if err != nil {
+        return err
+    }
+    ports, err := resolvePorts(daemonSet, portArgs)
+    if err != nil {
+        return err
+    }
+
+    ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+    defer stop()
+
+    for {
+        pod, err := waitForReadyDaemonPod(
+            ctx, clientset, ds, namespace, nodeName, "", timeout,
+        )
+        if ctx.Err() != nil {
+            return nil
+        }
+        if err != nil {
+            return fmt.Errorf(
+                "no ready pod for %s on node %s: %w", ds, nodeName, err,
+            )
+        }
+
+        forwarded, err := forwardToPod(
+            clientset, config, pod, addresses, ports, ctx.Done(), sv.out,
+        )
+        if err != nil {
+            return err
+        }
+        if ctx.Err() != nil {
+            return nil
+        }
+
+        // keep the local ports we got the first time, so whatever is
+        // connecting to them can reconnect
+        ports = nil
+        for _, port := range forwarded {
+            ports = append(
+                ports, fmt.Sprintf("%d:%d", port.Local, port.Remote),
+            )
+        }
+        fmt.Fprintf(
+            sv.out, "Lost pod %s, waiting for a ready pod on node %s\n",
+            pod.Name, nodeName,
+        )
+    }
+}
+
+// forwardToPod forwards ports to pod until we're interrupted, or the pod goes
+// away or stops being ready. It returns the ports it forwarded.
+func forwardToPod(
+    clientset *kubernetes.Clientset, config *rest.Config, pod *v1.Pod,
+    addresses []string, ports []string, interrupted <-chan struct{},
+    out io.Writer,
+) ([]portforward.ForwardedPort, error) {
+    transport, upgrader, err := spdy.RoundTripperFor(config)
+    if err != nil {
+        return nil, err
+    }
+    url := clientset.CoreV1().RESTClient().
+        Post().
+        Resource("pods").
+        Namespace(pod.Namespace).
+        Name(pod.Name).
+        SubResource("portforward").
+        URL()
+    dialer := spdy.NewDialer(
+        upgrader, &http.Client{Transport: transport}, "POST", url,
+    )
+
+    stop := make(chan struct{})
+    ready := make(chan struct{})
+    forwarder, err := portforward.NewOnAddresses(
+        dialer, addresses, ports, stop, ready, out, os.Stderr,
+    )
+    if err != nil {
+        return nil, err
+    }
+
+    done := make(chan struct{})
+    defer close(done)
+    go func() {
+        select {
+        case <-interrupted:
+        case <-podGone(clientset, pod, done):
+        case <-done:
+            return
+        }
+        close(stop)
+    }()
+
+    err = forwarder.ForwardPorts()
+    if err != nil && !errors.Is(err, portforward.ErrLostConnectionToPod) {
+        return nil, err
+    }
+    return forwarder.GetPorts()
+}
+
+// podGone returns a channel that's closed once pod is deleted, replaced or
+// not ready, since the connection to it doesn't always go away with it.
+func podGone(
+    clientset *kubernetes.Clientset, pod *v1.Pod, done <-chan struct{},
+) <-chan struct{} {
+    gone := make(chan struct{})
+    go func() {
+        ticker := time.NewTicker(pollInterval)
+        defer ticker.Stop()
+        for {
+            select {
+            case <-done:
+                return
+            case <-ticker.C:
+            }
+            current, err := clientset.CoreV1().Pods(pod.Namespace).Get(
+                context.TODO(), pod.Name, metav1.GetOptions{},
+            )
+            if err != nil && !apierrors.IsNotFound(err) {
+                // probably a blip, try again next time
+                continue
+            }
+            if err != nil || current.UID != pod.UID ||
+                    current.DeletionTimestamp != nil || !isPodReady(current) {
+                close(gone)
+                return
+            }
+        }
+    }()
+    return gone
+}
+
+// resolvePorts turns [LOCAL:]REMOTE port arguments into the LOCAL:REMOTE
+// form portforward wants, looking up named REMOTE ports in the containers of
+// ds.
+func resolvePorts(ds *appsv1.DaemonSet, portArgs []string) ([]string, error) {
+    var ports []string
+    for _, arg := range portArgs {
+        local, remote, found := strings.Cut(arg, ":")
+        if !found {
+            remote = arg
+        }
+        if _, err := strconv.ParseUint(remote, 10, 16); err != nil {
+            port, err := namedContainerPort(ds, remote)
+            if err != nil {
+                return nil, err
+            }
+            if !found {
+                local = strconv.Itoa(int(port))
+            }
+            remote = strconv.Itoa(int(port))
+        } else if !found {
+            local = remote
+        }
+        if local == "" {
+            local = "0"
+        }
+        ports = append(ports, local+":"+remote)
+    }
+    return ports, nil
+}
+
+func namedContainerPort(ds *appsv1.DaemonSet, name string) (int32, error) {
+    for _, container := range ds.Spec.Template.Spec.Containers {
+        for _, port := range container.Ports {
+            if port.Name == name {
+                return port.ContainerPort, nil
+            }
+        }
+    }
+    return 0, fmt.Errorf(
+        "daemonset %s has no container port named %q", ds.Name, name,
+    )
+}
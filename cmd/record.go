@@ -0,0 +1,233 @@
+package cmd
+
+import (
+    "encoding/json"
+    "fmt"
+    "io"
+    "os"
+    "os/user"
+    "path/filepath"
+    "strings"
+    "sync"
+    "time"
+    "unicode/utf8"
+
+    "github.com/spf13/cobra"
+    "golang.org/x/term"
+    v1 "k8s.io/api/core/v1"
+    "k8s.io/client-go/tools/remotecommand"
+)
+
+// castHeader is the first line of an asciinema v2 recording. Players ignore
+// fields they don't know, so we add what an auditor wants to know.
+type castHeader struct {
+    Version   int               `json:"version"`
+    Width     int               `json:"width"`
+    Height    int               `json:"height"`
+    Timestamp int64             `json:"timestamp"`
+    Command   string            `json:"command,omitempty"`
+    Title     string            `json:"title,omitempty"`
+    Env       map[string]string `json:"env,omitempty"`
+
+    User      string `json:"user,omitempty"`
+    KubeUser  string `json:"kube_user,omitempty"`
+    Context   string `json:"context,omitempty"`
+    Namespace string `json:"namespace,omitempty"`
+    Pod       string `json:"pod,omitempty"`
+    Container string `json:"container,omitempty"`
+    Node      string `json:"node,omitempty"`
+}
+
+// castRecorder writes an asciinema v2 recording: the header, then a line for
+// every bit of output ("o"), input ("i") and resize ("r").
+type castRecorder struct {
+    mu    sync.Mutex
+    file  *os.File
+    start time.Time
+}
+
+func newCastRecorder(path string, header castHeader) (*castRecorder, error) {
+    file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+    if err != nil {
+        return nil, err
+    }
+    data, err := json.Marshal(header)
+    if err != nil {
+        file.Close()
+        return nil, err
+    }
+    if _, err := fmt.Fprintf(file, "%s\n", data); err != nil {
+        file.Close()
+        return nil, err
+    }
+    return &castRecorder{file: file, start: time.Now()}, nil
+}
+
+func (r *castRecorder) event(code string, data string) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    elapsed := time.Since(r.start).Seconds()
+    line, err := json.Marshal([]interface{}{elapsed, code, data})
+    if err != nil {
+        return
+    }
+    // a broken recording shouldn't break the session
+    fmt.Fprintf(r.file, "%s\n", line)
+}
+
+func (r *castRecorder) Close() error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    return r.file.Close()
+}
+
+// record hooks the recorder into the streams of streamOptions.
+func (r *castRecorder) record(streamOptions *remotecommand.StreamOptions) {
+    if streamOptions.Stdin != nil {
+        streamOptions.Stdin = &recordingReader{
+            r: streamOptions.Stdin, recorder: r,
+        }
+    }
+    if streamOptions.Stdout != nil {
+        streamOptions.Stdout = &recordingWriter{
+            w: streamOptions.Stdout, recorder: r, code: "o",
+        }
+    }
+    if streamOptions.Stderr != nil {
+        streamOptions.Stderr = &recordingWriter{
+            w: streamOptions.Stderr, recorder: r, code: "o",
+        }
+    }
+    if streamOptions.TerminalSizeQueue != nil {
+        streamOptions.TerminalSizeQueue = &recordingSizeQueue{
+            queue: streamOptions.TerminalSizeQueue, recorder: r,
+        }
+    }
+}
+
+// recordingWriter records what's written through it. The recording is JSON,
+// so a UTF-8 character split between writes is held back until it's whole.
+type recordingWriter struct {
+    w        io.Writer
+    recorder *castRecorder
+    code     string
+    pending  []byte
+}
+
+func (w *recordingWriter) Write(p []byte) (int, error) {
+    n, err := w.w.Write(p)
+    data := append(w.pending, p[:n]...)
+    cut := len(data)
+    for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+        if utf8.RuneStart(data[i]) {
+            if !utf8.FullRune(data[i:]) {
+                cut = i
+            }
+            break
+        }
+    }
+    if cut > 0 {
+        w.recorder.event(w.code, string(data[:cut]))
+    }
+    w.pending = append([]byte{}, data[cut:]...)
+    return n, err
+}
+
+type recordingReader struct {
+    r        io.Reader
+    recorder *castRecorder
+}
+
+func (r *recordingReader) Read(p []byte) (int, error) {
+    n, err := r.r.Read(p)
+    if n > 0 {
+        r.recorder.event("i", string(p[:n]))
+    }
+    return n, err
+}
+
+type recordingSizeQueue struct {
+    queue    remotecommand.TerminalSizeQueue
+    recorder *castRecorder
+}
+
+func (q *recordingSizeQueue) Next() *remotecommand.TerminalSize {
+    size := q.queue.Next()
+    if size != nil {
+        q.recorder.event("r", fmt.Sprintf("%dx%d", size.Width, size.Height))
+    }
+    return size
+}
+
+func addRecordFlag(cmd *cobra.Command, record *string) {
+    cmd.Flags().StringVar(
+        record, "record", "",
+        "Record the session to this file, in asciinema format",
+    )
+}
+
+// startRecording starts recording a session with container in pod to path,
+// or if that's empty and config says to always record, to a new file in
+// the recording directory. It hooks the recording into streamOptions and
+// returns a function that finishes it, which does nothing when there's
+// nothing to record.
+func startRecording(
+    config *recordConfig, kcontext string, path string, pod *v1.Pod,
+    container string, command []string,
+    streamOptions *remotecommand.StreamOptions,
+) (func(), error) {
+    if path == "" {
+        if !config.Always {
+            return func() {}, nil
+        }
+        dir := config.recordDir()
+        if err := os.MkdirAll(dir, 0700); err != nil {
+            return nil, err
+        }
+        path = filepath.Join(dir, fmt.Sprintf(
+            "%s-%s.cast", time.Now().Format("20060102T150405"), pod.Name,
+        ))
+    }
+
+    contextName, kubeUser, err := getContextInfo(kcontext)
+    if err != nil {
+        return nil, err
+    }
+    header := castHeader{
+        Version:   2,
+        Width:     80,
+        Height:    24,
+        Timestamp: time.Now().Unix(),
+        Command:   strings.Join(command, " "),
+        Title: fmt.Sprintf(
+            "%s/%s on %s", pod.Namespace, pod.Name, pod.Spec.NodeName,
+        ),
+        Env: map[string]string{
+            "SHELL": os.Getenv("SHELL"), "TERM": os.Getenv("TERM"),
+        },
+        KubeUser:  kubeUser,
+        Context:   contextName,
+        Namespace: pod.Namespace,
+        Pod:       pod.Name,
+        Container: container,
+        Node:      pod.Spec.NodeName,
+    }
+    if current, err := user.Current(); err == nil {
+        header.User = current.Username
+    }
+    if width, height, err := term.GetSize(int(os.Stdin.Fd())); err == nil {
+        header.Width, header.Height = width, height
+    }
+
+    recorder, err := newCastRecorder(path, header)
+    if err != nil {
+        return nil, err
+    }
+    fmt.Fprintf(os.Stderr, "Recording session to %s\r\n", path)
+    recorder.record(streamOptions)
+    return func() {
+        if err := recorder.Close(); err != nil {
+            fmt.Fprintf(os.Stderr, "Error saving recording: %v\n", err)
+        }
+    }, nil
+}
@@ -0,0 +1,136 @@
+package cmd
+
+import (
+    "bufio"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "github.com/spf13/cobra"
+    "io"
+    "os"
+    "time"
+)
+
+func newDshReplayCommand(out io.Writer) *cobra.Command {
+    var speed float64
+    var maxWait time.Duration
+
+    dshReplay := &dshCmd{
+        out: out,
+    }
+
+    cmd := &cobra.Command{
+        Use:   "replay <file>",
+        Short: "play back a session recorded with --record",
+        Long:
+`Plays back a session recorded by exec, attach or debug with --record, in
+real time. Any asciinema v2 recording will do.`,
+        Args: cobra.MatchAll(cobra.ExactArgs(1)),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            if speed <= 0 {
+                return errors.New("--speed must be more than 0")
+            }
+            return dshReplay.replay(args[0], speed, maxWait)
+        },
+    }
+
+    cmd.Flags().Float64Var(
+        &speed, "speed", 1, "Play back this many times faster",
+    )
+    cmd.Flags().DurationVar(
+        &maxWait, "max-wait", 2*time.Second,
+        "Skip idle time longer than this (0 for no limit)",
+    )
+    return cmd
+}
+
+func (sv *dshCmd) replay(
+    path string, speed float64, maxWait time.Duration,
+) error {
+    file, err := os.Open(path)
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+
+    scanner := bufio.NewScanner(file)
+    scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+    if !scanner.Scan() {
+        if err := scanner.Err(); err != nil {
+            return err
+        }
+        return fmt.Errorf("%s is empty", path)
+    }
+    var header castHeader
+    if err := json.Unmarshal(scanner.Bytes(), &header); err != nil {
+        return fmt.Errorf("%s isn't an asciinema recording: %w", path, err)
+    }
+    if header.Version != 2 {
+        return fmt.Errorf(
+            "%s is asciinema version %d, only 2 is supported",
+            path, header.Version,
+        )
+    }
+    describeRecording(os.Stderr, &header)
+
+    var last float64
+    line := 1
+    for scanner.Scan() {
+        line++
+        var event []interface{}
+        if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+            return fmt.Errorf("%s line %d: %w", path, line, err)
+        }
+        if len(event) != 3 {
+            return fmt.Errorf("%s line %d: not an event", path, line)
+        }
+        at, ok1 := event[0].(float64)
+        code, ok2 := event[1].(string)
+        data, ok3 := event[2].(string)
+        if !ok1 || !ok2 || !ok3 {
+            return fmt.Errorf("%s line %d: not an event", path, line)
+        }
+        // input shows up as output when it's echoed, and we can't resize
+        // the terminal we're playing back on
+        if code != "o" {
+            continue
+        }
+
+        wait := time.Duration((at - last) / speed * float64(time.Second))
+        if maxWait > 0 && wait > maxWait {
+            wait = maxWait
+        }
+        time.Sleep(wait)
+        last = at
+        if _, err := io.WriteString(sv.out, data); err != nil {
+            return err
+        }
+    }
+    if err := scanner.Err(); err != nil {
+        return err
+    }
+    fmt.Fprintf(os.Stderr, "\r\n[end of recording]\r\n")
+    return nil
+}
+
+// describeRecording says whose session a recording is, when there's
+// anything to say.
+func describeRecording(out io.Writer, header *castHeader) {
+    if header.Pod == "" {
+        return
+    }
+    fmt.Fprintf(
+        out, "Recorded %s by %s as %s in context %s\r\n",
+        time.Unix(header.Timestamp, 0).Format(time.RFC1123),
+        orNone(header.User), orNone(header.KubeUser), orNone(header.Context),
+    )
+    fmt.Fprintf(
+        out, "Pod %s/%s, container %s, on node %s\r\n",
+        header.Namespace, header.Pod, orNone(header.Container),
+        orNone(header.Node),
+    )
+    if header.Command != "" {
+        fmt.Fprintf(out, "Command: %s\r\n", header.Command)
+    }
+    fmt.Fprintf(out, "\r\n")
+}
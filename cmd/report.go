@@ -0,0 +1,166 @@
+package cmd
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "io"
+    "sort"
+
+    appsv1 "k8s.io/api/apps/v1"
+    v1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/client-go/kubernetes"
+    "k8s.io/client-go/rest"
+    "sigs.k8s.io/yaml"
+)
+
+// podReport is everything describe knows about a daemonset pod, in one
+// document that's easy for a machine to consume.
+type podReport struct {
+    Pod       *v1.Pod           `json:"pod"`
+    // not with --show-events=false
+    Events    []v1.Event        `json:"events,omitempty"`
+    Node      *nodeReport       `json:"node,omitempty"`
+    DaemonSet *daemonSetSummary `json:"daemonSet,omitempty"`
+
+    // only with --resolve-env
+    Environment   []containerEnv  `json:"environment,omitempty"`
+    MountedConfig []mountedConfig `json:"mountedConfig,omitempty"`
+}
+
+type nodeReport struct {
+    Name          string             `json:"name"`
+    Unschedulable bool               `json:"unschedulable"`
+    Taints        []v1.Taint         `json:"taints,omitempty"`
+    Conditions    []v1.NodeCondition `json:"conditions"`
+}
+
+type daemonSetSummary struct {
+    Name            string                         `json:"name"`
+    Namespace       string                         `json:"namespace"`
+    Generation      int64                          `json:"generation"`
+    UpdateStrategy  appsv1.DaemonSetUpdateStrategy `json:"updateStrategy"`
+    CurrentRevision string                         `json:"currentRevision,omitempty"`
+    Status          appsv1.DaemonSetStatus         `json:"status"`
+}
+
+// buildPodReport gathers pod's events and those of its node and daemonset,
+// sorted by time, unless opts says not to show events, along with the
+// node's conditions and a summary of the daemonset.
+func buildPodReport(
+    clientset *kubernetes.Clientset, config *rest.Config, namespace string,
+    pod *v1.Pod, opts describeOptions,
+) (*podReport, error) {
+    pod, err := clientset.CoreV1().Pods(namespace).Get(
+        context.TODO(), pod.Name, metav1.GetOptions{},
+    )
+    if err != nil {
+        return nil, err
+    }
+    pod.SetGroupVersionKind(v1.SchemeGroupVersion.WithKind("Pod"))
+
+    report := &podReport{Pod: pod}
+    if opts.showEvents {
+        events, err := getEvents(
+            clientset, namespace, "Pod", pod.Name, pod.UID,
+        )
+        if err != nil {
+            return nil, err
+        }
+        report.Events = events.Items
+    }
+
+    if opts.resolveEnv {
+        resolver := newEnvResolver(clientset, config, pod, opts.showSecrets)
+        report.Environment = resolver.resolveAll()
+        report.MountedConfig = resolver.mountedConfigs()
+    }
+
+    if pod.Spec.NodeName != "" {
+        node, err := clientset.CoreV1().Nodes().Get(
+            context.TODO(), pod.Spec.NodeName, metav1.GetOptions{},
+        )
+        if err != nil {
+            return nil, err
+        }
+        report.Node = &nodeReport{
+            Name:          node.Name,
+            Unschedulable: node.Spec.Unschedulable,
+            Taints:        node.Spec.Taints,
+            Conditions:    node.Status.Conditions,
+        }
+        if opts.showEvents {
+            // the kubelet reports node events with the node name as the
+            // UID, so match on the name only, the same as describe node does
+            nodeEvents, err := getEvents(
+                clientset, "", "Node", node.Name, "",
+            )
+            if err != nil {
+                return nil, err
+            }
+            report.Events = append(report.Events, nodeEvents.Items...)
+        }
+    }
+
+    if name := daemonSetOwner(pod, ""); name != "" {
+        ds, err := clientset.AppsV1().DaemonSets(namespace).Get(
+            context.TODO(), name, metav1.GetOptions{},
+        )
+        if err != nil {
+            return nil, err
+        }
+        revisions, err := getDaemonSetRevisions(clientset, ds)
+        if err != nil {
+            return nil, err
+        }
+        report.DaemonSet = &daemonSetSummary{
+            Name:           ds.Name,
+            Namespace:      ds.Namespace,
+            Generation:     ds.Generation,
+            UpdateStrategy: ds.Spec.UpdateStrategy,
+            Status:         ds.Status,
+        }
+        if len(revisions) > 0 {
+            report.DaemonSet.CurrentRevision = revisions[0].hash
+        }
+        if opts.showEvents {
+            dsEvents, err := getEvents(
+                clientset, namespace, "DaemonSet", ds.Name, ds.UID,
+            )
+            if err != nil {
+                return nil, err
+            }
+            report.Events = append(report.Events, dsEvents.Items...)
+        }
+    }
+
+    sort.SliceStable(report.Events, func(i, j int) bool {
+        return report.Events[i].LastTimestamp.Before(
+            &report.Events[j].LastTimestamp,
+        )
+    })
+    return report, nil
+}
+
+// printReport prints report as json or yaml. Each report is a document of
+// its own, so a stream of them can be read with 'jq' or split on '---'.
+func printReport(out io.Writer, output string, report interface{}) error {
+    switch output {
+    case "json":
+        data, err := json.MarshalIndent(report, "", "    ")
+        if err != nil {
+            return err
+        }
+        _, err = fmt.Fprintln(out, string(data))
+        return err
+    case "yaml":
+        data, err := yaml.Marshal(report)
+        if err != nil {
+            return err
+        }
+        _, err = fmt.Fprintf(out, "---\n%s", data)
+        return err
+    }
+    return fmt.Errorf("unknown output format %q, must be json or yaml", output)
+}
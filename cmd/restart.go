@@ -0,0 +1,132 @@
+package cmd
+
+import (
+    "context"
+    "fmt"
+    "time"
+
+    v1 "k8s.io/api/core/v1"
+    apierrors "k8s.io/apimachinery/pkg/api/errors"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/types"
+    "k8s.io/apimachinery/pkg/util/wait"
+    "k8s.io/client-go/kubernetes"
+)
+
+// How often we check on a pod we're waiting for
+const pollInterval = 2 * time.Second
+
+// restartDaemonPod deletes pod and waits for the daemonset to replace it
+// with a pod that is ready, on the same node.
+func restartDaemonPod(
+    clientset *kubernetes.Clientset, pod *v1.Pod, timeout time.Duration,
+) (*v1.Pod, error) {
+    err := clientset.CoreV1().Pods(pod.Namespace).Delete(
+        context.TODO(), pod.Name, metav1.DeleteOptions{},
+    )
+    if err != nil {
+        auditPod("restart", pod, err)
+        return nil, err
+    }
+    replacement, err := waitForReplacementPod(clientset, pod, timeout)
+    auditPod("restart", pod, err)
+    return replacement, err
+}
+
+// waitForPodGone waits for pod to be deleted, or replaced by one with the
+// same name.
+func waitForPodGone(
+    clientset *kubernetes.Clientset, pod *v1.Pod, timeout time.Duration,
+) error {
+    err := wait.PollUntilContextTimeout(
+        context.TODO(), pollInterval, timeout, true,
+        func(ctx context.Context) (bool, error) {
+            current, err := clientset.CoreV1().Pods(pod.Namespace).Get(
+                ctx, pod.Name, metav1.GetOptions{},
+            )
+            if apierrors.IsNotFound(err) {
+                return true, nil
+            }
+            if err != nil {
+                return false, err
+            }
+            return current.UID != pod.UID, nil
+        },
+    )
+    if err != nil {
+        return fmt.Errorf(
+            "pod %s still there after %s: %w", pod.Name, timeout, err,
+        )
+    }
+    return nil
+}
+
+// waitForReplacementPod waits for a ready pod of the same daemonset as old,
+// on the same node, that isn't old.
+func waitForReplacementPod(
+    clientset *kubernetes.Clientset, old *v1.Pod, timeout time.Duration,
+) (*v1.Pod, error) {
+    pod, err := waitForReadyDaemonPod(
+        context.TODO(), clientset, daemonSetOwner(old, ""), old.Namespace,
+        old.Spec.NodeName, old.UID, timeout,
+    )
+    if err != nil {
+        return nil, fmt.Errorf(
+            "no ready replacement for pod %s on node %s after %s: %w",
+            old.Name, old.Spec.NodeName, timeout, err,
+        )
+    }
+    return pod, nil
+}
+
+// waitForReadyDaemonPod waits for a ready pod of ds on nodeName, other than
+// the one with UID exclude, if any.
+func waitForReadyDaemonPod(
+    ctx context.Context, clientset *kubernetes.Clientset, ds string,
+    namespace string, nodeName string, exclude types.UID,
+    timeout time.Duration,
+) (*v1.Pod, error) {
+    listOptions, err := daemonSetListOptions(
+        clientset, ds, namespace, nodeName,
+    )
+    if err != nil {
+        return nil, err
+    }
+
+    var ready *v1.Pod
+    err = wait.PollUntilContextTimeout(
+        ctx, pollInterval, timeout, true,
+        func(ctx context.Context) (bool, error) {
+            podList, err := clientset.CoreV1().Pods(namespace).List(
+                ctx, listOptions,
+            )
+            if err != nil {
+                return false, err
+            }
+            for i := range podList.Items {
+                pod := &podList.Items[i]
+                if pod.UID == exclude || daemonSetOwner(pod, ds) == "" ||
+                        pod.DeletionTimestamp != nil || !isPodReady(pod) {
+                    continue
+                }
+                ready = pod
+                return true, nil
+            }
+            return false, nil
+        },
+    )
+    if err != nil {
+        return nil, err
+    }
+    return ready, nil
+}
+
+// podReadyTime is when pod last became ready.
+func podReadyTime(pod *v1.Pod) metav1.Time {
+    for _, condition := range pod.Status.Conditions {
+        if condition.Type == v1.PodReady {
+            return condition.LastTransitionTime
+        }
+    }
+    return metav1.Time{}
+}
@@ -0,0 +1,262 @@
+package cmd
+
+import (
+    "errors"
+    "fmt"
+    "github.com/spf13/cobra"
+    "io"
+    "sort"
+    "strings"
+    "time"
+
+    v1 "k8s.io/api/core/v1"
+    "k8s.io/cli-runtime/pkg/printers"
+    "k8s.io/client-go/kubernetes"
+)
+
+// The annotation on a daemonset's pod template listing the daemonsets its
+// pods must be restarted after
+const afterAnnotation = "kubectl-daemons/after"
+
+// restartStep is one daemon restart-node restarts, and how it went
+type restartStep struct {
+    // <namespace>/<name> of the daemonset
+    ds          string
+    pod         *v1.Pod
+    replacement *v1.Pod
+    err         error
+}
+
+func newDshRestartNodeCommand(
+    out io.Writer, context *string, namespace *string, nodeName *string,
+    config *dshConfig,
+) *cobra.Command {
+    var dryRun bool
+    var timeout time.Duration
+
+    dshRestartNode := &dshCmd{
+        out:    out,
+        config: config,
+    }
+
+    cmd := &cobra.Command{
+        Use:   "restart-node [<node>] [<options>]",
+        Short: "restart every daemon on a node, in dependency order",
+        Long:
+`Restarts the pods of every daemonset on a node, one at a time, waiting for
+each replacement to be ready before going on to the next. You can pass in the
+node as the arg, or use -N.
+
+The order follows the dependencies in restart.after in the config file, and
+in the kubectl-daemons/after annotation on each daemonset's pod template, a
+comma-separated list of the daemonsets it comes after. Either way, a
+daemonset is <name> or <namespace>/<name>, and dependencies that aren't on
+the node are ignored. Daemonsets without dependencies between them go in
+the order of maintain.restartOrder, then by name.
+
+If a daemon isn't ready in time, we stop there, and show what was and
+wasn't restarted.
+
+Daemonsets in every namespace are restarted, unless you give -n.`,
+        Annotations: map[string]string{
+            allNamespacesAnnotation: "true", nodeArgAnnotation: "true",
+        },
+        Args: cobra.MatchAll(cobra.MaximumNArgs(1)),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            if len(args) == 1 {
+                *nodeName = args[0]
+            }
+            if *nodeName == "" {
+                return errors.New("you must specify a node")
+            }
+            ns := *namespace
+            if !cmd.Flags().Changed("namespace") {
+                ns = ""
+            }
+            clientset, _, err := getClientSet(*context)
+            if err != nil {
+                return err
+            }
+            return dshRestartNode.restartNodeDaemons(
+                clientset, ns, *nodeName, timeout, dryRun,
+            )
+        },
+    }
+
+    cmd.Flags().BoolVar(
+        &dryRun, "dry-run", false,
+        "Only show the order the daemons would be restarted in",
+    )
+    cmd.Flags().DurationVar(
+        &timeout, "timeout", 5*time.Minute,
+        "How long to wait for each daemon to be ready",
+    )
+    return cmd
+}
+
+// restartNodeDaemons restarts every daemonset pod on nodeName, one at a
+// time in dependency order, waiting for each replacement to be ready.
+func (sv *dshCmd) restartNodeDaemons(
+    clientset *kubernetes.Clientset, namespace string, nodeName string,
+    timeout time.Duration, dryRun bool,
+) error {
+    pods, err := getPodsForDaemonSet(clientset, "", namespace, nodeName)
+    if err != nil {
+        return err
+    }
+    if len(pods) == 0 {
+        fmt.Printf("No pods found\n")
+        return nil
+    }
+
+    steps, err := orderRestarts(pods, sv.config)
+    if err != nil {
+        return err
+    }
+
+    if dryRun {
+        for i, step := range steps {
+            fmt.Fprintf(
+                sv.out, "%d. %s (pod %s)\n", i+1, step.ds, step.pod.Name,
+            )
+        }
+        return nil
+    }
+    if err := preflight(clientset, namespace, permDeletePods); err != nil {
+        return err
+    }
+
+    for i := range steps {
+        step := &steps[i]
+        fmt.Fprintf(sv.out, "Restarting %s\n", step.ds)
+        step.replacement, step.err = restartDaemonPod(
+            clientset, step.pod, timeout,
+        )
+        if step.err != nil {
+            if err := sv.printRestartReport(steps); err != nil {
+                return err
+            }
+            return fmt.Errorf(
+                "stopped after %s failed, %d of %d daemons restarted",
+                step.ds, i, len(steps),
+            )
+        }
+        fmt.Fprintf(
+            sv.out, "pod \"%s\" ready at %s\n", step.replacement.Name,
+            podReadyTime(step.replacement).Format(time.RFC1123),
+        )
+    }
+    return nil
+}
+
+// orderRestarts puts the daemonset pods in pods in the order they should be
+// restarted in, so each comes after the ones it depends on.
+func orderRestarts(pods []v1.Pod, config *dshConfig) ([]restartStep, error) {
+    steps := make(map[string]*restartStep)
+    byName := make(map[string][]string)
+    for i := range pods {
+        pod := &pods[i]
+        name := daemonSetOwner(pod, "")
+        key := pod.Namespace + "/" + name
+        steps[key] = &restartStep{ds: key, pod: pod}
+        byName[name] = append(byName[name], key)
+    }
+
+    // resolve turns a <name> or <namespace>/<name> into the daemonsets on
+    // the node it refers to
+    resolve := func(ref string) []string {
+        ref = strings.TrimSpace(ref)
+        if strings.Contains(ref, "/") {
+            if _, ok := steps[ref]; ok {
+                return []string{ref}
+            }
+            return nil
+        }
+        return byName[ref]
+    }
+
+    deps := make(map[string]map[string]bool)
+    for key, step := range steps {
+        name := daemonSetOwner(step.pod, "")
+        refs := append(
+            append([]string{}, config.Restart.After[name]...),
+            config.Restart.After[key]...,
+        )
+        if value := step.pod.Annotations[afterAnnotation]; value != "" {
+            refs = append(refs, strings.Split(value, ",")...)
+        }
+        deps[key] = make(map[string]bool)
+        for _, ref := range refs {
+            for _, dep := range resolve(ref) {
+                if dep != key {
+                    deps[key][dep] = true
+                }
+            }
+        }
+    }
+
+    rank := func(key string) int {
+        name := daemonSetOwner(steps[key].pod, "")
+        for i, ref := range config.Maintain.RestartOrder {
+            if ref == name || ref == key {
+                return i
+            }
+        }
+        return len(config.Maintain.RestartOrder)
+    }
+
+    var order []restartStep
+    for len(steps) > 0 {
+        var ready []string
+        for key := range steps {
+            if len(deps[key]) == 0 {
+                ready = append(ready, key)
+            }
+        }
+        if len(ready) == 0 {
+            var stuck []string
+            for key := range steps {
+                stuck = append(stuck, key)
+            }
+            sort.Strings(stuck)
+            return nil, fmt.Errorf(
+                "there's a dependency cycle among: %s",
+                strings.Join(stuck, ", "),
+            )
+        }
+        sort.Slice(ready, func(i, j int) bool {
+            ri, rj := rank(ready[i]), rank(ready[j])
+            if ri != rj {
+                return ri < rj
+            }
+            return ready[i] < ready[j]
+        })
+        next := ready[0]
+        order = append(order, *steps[next])
+        delete(steps, next)
+        for _, d := range deps {
+            delete(d, next)
+        }
+    }
+    return order, nil
+}
+
+// printRestartReport shows how each restart went, or that it didn't happen.
+func (sv *dshCmd) printRestartReport(steps []restartStep) error {
+    w := printers.GetNewTabWriter(sv.out)
+    fmt.Fprintln(w, "DAEMONSET\tPOD\tRESULT")
+    for _, step := range steps {
+        result := "not restarted"
+        switch {
+        case step.err != nil:
+            result = fmt.Sprintf("FAILED: %v", step.err)
+        case step.replacement != nil:
+            result = fmt.Sprintf(
+                "restarted, \"%s\" ready at %s", step.replacement.Name,
+                podReadyTime(step.replacement).Format(time.RFC1123),
+            )
+        }
+        fmt.Fprintf(w, "%s\t%s\t%s\n", step.ds, step.pod.Name, result)
+    }
+    return w.Flush()
+}
@@ -0,0 +1,143 @@
+package cmd
+
+import (
+    "strings"
+    "testing"
+
+    v1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// daemonPod is the pod of ds, "<namespace>/<name>", with the daemonsets it
+// has to be restarted after, if any, in its annotation.
+func daemonPod(ds string, after string) v1.Pod {
+    namespace, name, _ := strings.Cut(ds, "/")
+    pod := v1.Pod{ObjectMeta: metav1.ObjectMeta{
+        Namespace: namespace,
+        Name:      name + "-abcde",
+        OwnerReferences: []metav1.OwnerReference{
+            {Kind: "DaemonSet", Name: name},
+        },
+    }}
+    if after != "" {
+        pod.Annotations = map[string]string{afterAnnotation: after}
+    }
+    return pod
+}
+
+func TestOrderRestarts(t *testing.T) {
+    tests := []struct {
+        name    string
+        pods    []v1.Pod
+        config  dshConfig
+        want    string
+        wantErr string
+    }{
+        {
+            name: "by name without dependencies",
+            pods: []v1.Pod{
+                daemonPod("kube-system/proxy", ""),
+                daemonPod("kube-system/dns", ""),
+                daemonPod("infra/agent", ""),
+            },
+            want: "infra/agent kube-system/dns kube-system/proxy",
+        },
+        {
+            name: "restartOrder first",
+            pods: []v1.Pod{
+                daemonPod("kube-system/proxy", ""),
+                daemonPod("kube-system/dns", ""),
+                daemonPod("infra/agent", ""),
+            },
+            config: dshConfig{Maintain: maintainConfig{
+                RestartOrder: []string{"kube-system/proxy", "dns"},
+            }},
+            want: "kube-system/proxy kube-system/dns infra/agent",
+        },
+        {
+            name: "dependencies from the config",
+            pods: []v1.Pod{
+                daemonPod("infra/agent", ""),
+                daemonPod("kube-system/cni", ""),
+                daemonPod("kube-system/dns", ""),
+            },
+            config: dshConfig{Restart: restartConfig{After: map[string][]string{
+                "agent":           {"dns"},
+                "kube-system/dns": {"kube-system/cni"},
+            }}},
+            want: "kube-system/cni kube-system/dns infra/agent",
+        },
+        {
+            name: "dependencies from the annotation",
+            pods: []v1.Pod{
+                daemonPod("infra/agent", "dns, kube-system/cni"),
+                daemonPod("kube-system/cni", ""),
+                daemonPod("kube-system/dns", ""),
+            },
+            want: "kube-system/cni kube-system/dns infra/agent",
+        },
+        {
+            name: "dependencies win over restartOrder",
+            pods: []v1.Pod{
+                daemonPod("infra/agent", "cni"),
+                daemonPod("kube-system/cni", ""),
+            },
+            config: dshConfig{Maintain: maintainConfig{
+                RestartOrder: []string{"agent"},
+            }},
+            want: "kube-system/cni infra/agent",
+        },
+        {
+            name: "dependencies not on the node are ignored",
+            pods: []v1.Pod{
+                daemonPod("infra/agent", "dns,other/cni,agent"),
+            },
+            want: "infra/agent",
+        },
+        {
+            name: "a name in several namespaces",
+            pods: []v1.Pod{
+                daemonPod("infra/agent", "proxy"),
+                daemonPod("a/proxy", ""),
+                daemonPod("b/proxy", ""),
+            },
+            config: dshConfig{Maintain: maintainConfig{
+                RestartOrder: []string{"agent"},
+            }},
+            want: "a/proxy b/proxy infra/agent",
+        },
+        {
+            name: "cycle",
+            pods: []v1.Pod{
+                daemonPod("infra/agent", "dns"),
+                daemonPod("kube-system/cni", ""),
+                daemonPod("kube-system/dns", "proxy"),
+                daemonPod("kube-system/proxy", "agent"),
+            },
+            wantErr: "there's a dependency cycle among: infra/agent, " +
+                "kube-system/dns, kube-system/proxy",
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            steps, err := orderRestarts(tt.pods, &tt.config)
+            if tt.wantErr != "" {
+                if err == nil || err.Error() != tt.wantErr {
+                    t.Fatalf("got error %v, want %q", err, tt.wantErr)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatal(err)
+            }
+            var order []string
+            for _, step := range steps {
+                order = append(order, step.ds)
+            }
+            if got := strings.Join(order, " "); got != tt.want {
+                t.Errorf("got %q, want %q", got, tt.want)
+            }
+        })
+    }
+}
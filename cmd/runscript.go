@@ -0,0 +1,260 @@
+package cmd
+
+import (
+    "bytes"
+    "errors"
+    "fmt"
+    "github.com/spf13/cobra"
+    "io"
+    "os"
+    "sort"
+    "strings"
+    "sync"
+
+    v1 "k8s.io/api/core/v1"
+    "k8s.io/cli-runtime/pkg/printers"
+    "k8s.io/client-go/kubernetes"
+    "k8s.io/client-go/rest"
+    "k8s.io/client-go/tools/remotecommand"
+    utilexec "k8s.io/client-go/util/exec"
+)
+
+func newDshRunScriptCommand(
+    out io.Writer, context *string, namespace *string, nodeName *string,
+) *cobra.Command {
+    var container string
+    var interpreter string
+    var env []string
+    var all bool
+    var parallel int
+
+    dshRunScript := &dshCmd{
+        out: out,
+    }
+
+    cmd := &cobra.Command{
+        Use:   "run-script <daemonset> <script> [<options>] [-- args...]",
+        Short: "run a local script in pods for <daemonset>",
+        Long:
+`Runs a local script in the pod of the specified daemonset on the specified
+node, or with --all, on every node. The script is streamed to the interpreter
+over stdin, so nothing is left behind in the container. Arguments after the
+script are passed to it. For example:
+
+kubectl d run-script my-daemonset ./check.sh -N my-node -- --verbose
+
+The interpreter is the command the script is piped into, and has to read the
+script from stdin. For python, use --interpreter 'python3 -'.
+
+With --all, the output of each node is printed once its script is done,
+followed by the exit code of every node.`,
+        Annotations: map[string]string{daemonSetArgAnnotation: "true"},
+        Args: cobra.MatchAll(cobra.MinimumNArgs(2)),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            if all == (*nodeName != "") {
+                return errors.New("exactly one of -N or --all is required")
+            }
+            if parallel < 1 {
+                return errors.New("--parallel must be at least 1")
+            }
+            for _, e := range env {
+                if !strings.Contains(e, "=") {
+                    return fmt.Errorf("--env must be NAME=VALUE, got %q", e)
+                }
+            }
+            return dshRunScript.runScript(
+                *context, *namespace, args[0], *nodeName, container,
+                strings.Fields(interpreter), env, parallel, args[1], args[2:],
+            )
+        },
+    }
+
+    cmd.Flags().StringVarP(
+        &container, "container", "c", "", "The container to run the script in",
+    )
+    cmd.Flags().StringVar(
+        &interpreter, "interpreter", "/bin/sh -s --",
+        "The command to pipe the script into, followed by the script's arguments",
+    )
+    cmd.Flags().StringArrayVarP(
+        &env, "env", "e", nil,
+        "Environment variable to set for the script, as NAME=VALUE (repeatable)",
+    )
+    cmd.Flags().SetAnnotation("env", auditRedactAnnotation, []string{"true"})
+    cmd.Flags().BoolVar(
+        &all, "all", false, "Run the script on every node",
+    )
+    cmd.Flags().IntVarP(
+        &parallel, "parallel", "p", 5,
+        "How many nodes to run the script on at once with --all",
+    )
+    return cmd
+}
+
+// scriptResult is the outcome of running a script in one pod.
+type scriptResult struct {
+    pod      *v1.Pod
+    output   bytes.Buffer
+    exitCode int
+    err      error
+}
+
+func (sv *dshCmd) runScript(
+    kcontext string, namespace string, ds string, nodeName string,
+    container string, interpreter []string, env []string, parallel int,
+    scriptPath string, args []string,
+) error {
+    script, err := os.ReadFile(scriptPath)
+    if err != nil {
+        return err
+    }
+
+    clientset, config, err := getClientSet(kcontext)
+    if err != nil {
+        return err
+    }
+    err = preflight(clientset, namespace, permListPods, permExec)
+    if err != nil {
+        return err
+    }
+
+    pods, err := getPodsForDaemonSet(clientset, ds, namespace, nodeName)
+    if err != nil {
+        return err
+    }
+
+    if len(pods) == 0 {
+        fmt.Printf("No pods found\n")
+        return nil
+    }
+
+    // 'env' is everywhere 'sh' is, and unlike exporting the variables at the
+    // top of the script, works with any interpreter
+    var cmd []string
+    if len(env) > 0 {
+        cmd = append(append([]string{"env"}, env...), interpreter...)
+    } else {
+        cmd = append([]string{}, interpreter...)
+    }
+    cmd = append(cmd, args...)
+
+    if nodeName != "" {
+        if len(pods) > 1 {
+            fmt.Printf("More than one pod found, wut?!")
+            return nil
+        }
+        err := streamExec(
+            clientset, config, namespace, pods[0].Name, container, cmd,
+            remotecommand.StreamOptions{
+                Stdin:  bytes.NewReader(script),
+                Stdout: sv.out,
+                Stderr: os.Stderr,
+            },
+        )
+        auditPod("run-script", &pods[0], err)
+        return err
+    }
+
+    sort.Slice(pods, func(i, j int) bool {
+        return pods[i].Spec.NodeName < pods[j].Spec.NodeName
+    })
+    results := make([]*scriptResult, len(pods))
+    var wg sync.WaitGroup
+    limit := make(chan struct{}, parallel)
+    for i := range pods {
+        results[i] = &scriptResult{pod: &pods[i]}
+        wg.Add(1)
+        go func(result *scriptResult) {
+            defer wg.Done()
+            limit <- struct{}{}
+            defer func() { <-limit }()
+            runScriptInPod(
+                clientset, config, namespace, container, cmd, script, result,
+            )
+        }(results[i])
+    }
+    wg.Wait()
+
+    return sv.printScriptResults(results)
+}
+
+// runScriptInPod runs the script in result's pod, recording its output,
+// interleaved the way it would be on a terminal, and how it exited.
+func runScriptInPod(
+    clientset *kubernetes.Clientset, config *rest.Config, namespace string,
+    container string, cmd []string, script []byte, result *scriptResult,
+) {
+    output := &lockedWriter{w: &result.output}
+    err := streamExec(
+        clientset, config, namespace, result.pod.Name, container, cmd,
+        remotecommand.StreamOptions{
+            Stdin:  bytes.NewReader(script),
+            Stdout: output,
+            Stderr: output,
+        },
+    )
+    auditPod("run-script", result.pod, err)
+    var exitErr utilexec.ExitError
+    switch {
+    case err == nil:
+    case errors.As(err, &exitErr):
+        result.exitCode = exitErr.ExitStatus()
+    default:
+        // we never found out how the script did
+        result.exitCode = -1
+        result.err = err
+    }
+}
+
+// lockedWriter lets stdout and stderr, which are copied from different
+// goroutines, share a buffer.
+type lockedWriter struct {
+    mu sync.Mutex
+    w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    return l.w.Write(p)
+}
+
+func (sv *dshCmd) printScriptResults(results []*scriptResult) error {
+    failed := 0
+    for _, result := range results {
+        fmt.Fprintf(sv.out, "==> %s <==\n", result.pod.Spec.NodeName)
+        output := result.output.Bytes()
+        sv.out.Write(output)
+        if len(output) > 0 && !bytes.HasSuffix(output, []byte("\n")) {
+            fmt.Fprintln(sv.out)
+        }
+        fmt.Fprintln(sv.out)
+        if result.exitCode != 0 {
+            failed++
+        }
+    }
+
+    w := printers.GetNewTabWriter(sv.out)
+    fmt.Fprintln(w, "NODE\tPOD\tEXIT CODE\tERROR")
+    for _, result := range results {
+        exitCode := fmt.Sprint(result.exitCode)
+        message := "<none>"
+        if result.err != nil {
+            exitCode, message = "?", result.err.Error()
+        }
+        fmt.Fprintf(
+            w, "%s\t%s\t%s\t%s\n", result.pod.Spec.NodeName, result.pod.Name,
+            exitCode, message,
+        )
+    }
+    if err := w.Flush(); err != nil {
+        return err
+    }
+
+    if failed > 0 {
+        return fmt.Errorf(
+            "script failed on %d of %d nodes", failed, len(results),
+        )
+    }
+    return nil
+}
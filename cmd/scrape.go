@@ -0,0 +1,261 @@
+package cmd
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "github.com/spf13/cobra"
+    "io"
+    "os"
+    "regexp"
+    "sort"
+    "strconv"
+    "sync"
+
+    v1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/cli-runtime/pkg/printers"
+    "k8s.io/client-go/kubernetes"
+    "golang.org/x/term"
+)
+
+func newDshScrapeCommand(
+    out io.Writer, context *string, namespace *string, nodeName *string,
+) *cobra.Command {
+    var port string
+    var path string
+    var scheme string
+    var match string
+    var parallel int
+
+    dshScrape := &dshCmd{
+        out: out,
+    }
+
+    cmd := &cobra.Command{
+        Use:   "scrape <daemonset> [<options>]",
+        Short: "compare the metrics of pods for <daemonset> across nodes",
+        Long:
+`Fetches the Prometheus metrics of every pod of the specified daemonset, or
+the one on the specified node, through the API server's pod proxy, and shows
+the series matching --match for each node. Values that are far from those on
+the other nodes are marked as outliers. For example:
+
+kubectl d scrape my-daemonset --port metrics --match 'queue_depth|errors_total'`,
+        Annotations: map[string]string{daemonSetArgAnnotation: "true"},
+        Args: cobra.MatchAll(cobra.ExactArgs(1)),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            matcher, err := regexp.Compile(match)
+            if err != nil {
+                return fmt.Errorf("bad --match: %w", err)
+            }
+            if parallel < 1 {
+                return errors.New("--parallel must be at least 1")
+            }
+            return dshScrape.scrape(
+                *context, *namespace, args[0], *nodeName, scheme, port, path,
+                matcher, parallel,
+            )
+        },
+    }
+
+    cmd.Flags().StringVar(
+        &port, "port", "metrics",
+        "The container port to scrape, by name or number",
+    )
+    cmd.Flags().StringVar(
+        &path, "path", "/metrics", "The path to scrape",
+    )
+    cmd.Flags().StringVar(
+        &scheme, "scheme", "http", "The scheme to scrape with, http or https",
+    )
+    cmd.Flags().StringVar(
+        &match, "match", "",
+        "Only show series matching this regex (default: all of them)",
+    )
+    cmd.Flags().IntVarP(
+        &parallel, "parallel", "p", 10, "How many pods to scrape at once",
+    )
+    return cmd
+}
+
+// scrapeResult is the metrics of one pod, or why we don't have them.
+type scrapeResult struct {
+    pod    *v1.Pod
+    series map[string]float64
+    err    error
+}
+
+// scrapeFunc fetches the metrics of pod.
+type scrapeFunc func(pod *v1.Pod) ([]byte, error)
+
+func (sv *dshCmd) scrape(
+    kcontext string, namespace string, ds string, nodeName string,
+    scheme string, port string, path string, matcher *regexp.Regexp,
+    parallel int,
+) error {
+    clientset, _, err := getClientSet(kcontext)
+    if err != nil {
+        return err
+    }
+
+    pods, err := getPodsForDaemonSet(clientset, ds, namespace, nodeName)
+    if err != nil {
+        return err
+    }
+
+    if len(pods) == 0 {
+        fmt.Printf("No pods found\n")
+        return nil
+    }
+
+    if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+        daemonSet, err := clientset.AppsV1().DaemonSets(namespace).Get(
+            context.TODO(), ds, metav1.GetOptions{},
+        )
+        if err != nil {
+            return err
+        }
+        number, err := namedContainerPort(daemonSet, port)
+        if err != nil {
+            return err
+        }
+        port = strconv.Itoa(int(number))
+    }
+
+    results := scrapePods(
+        pods, proxyScraper(clientset, scheme, port, path), parallel,
+    )
+    return sv.printScrapeResults(results, matcher)
+}
+
+// proxyScraper scrapes pods through the API server's pod proxy, so it works
+// from wherever kubectl does.
+func proxyScraper(
+    clientset *kubernetes.Clientset, scheme string, port string, path string,
+) scrapeFunc {
+    return func(pod *v1.Pod) ([]byte, error) {
+        return clientset.CoreV1().Pods(pod.Namespace).
+            ProxyGet(scheme, pod.Name, port, path, nil).
+            DoRaw(context.TODO())
+    }
+}
+
+// scrapePods scrapes every pod with fetch, parallel at a time, and parses
+// what it gets. The results are sorted by node.
+func scrapePods(pods []v1.Pod, fetch scrapeFunc, parallel int) []*scrapeResult {
+    sort.Slice(pods, func(i, j int) bool {
+        return pods[i].Spec.NodeName < pods[j].Spec.NodeName
+    })
+    results := make([]*scrapeResult, len(pods))
+    var wg sync.WaitGroup
+    limit := make(chan struct{}, parallel)
+    for i := range pods {
+        results[i] = &scrapeResult{pod: &pods[i]}
+        wg.Add(1)
+        go func(result *scrapeResult) {
+            defer wg.Done()
+            limit <- struct{}{}
+            defer func() { <-limit }()
+            data, err := fetch(result.pod)
+            if err == nil {
+                result.series, err = parseMetrics(data)
+            }
+            result.err = err
+        }(results[i])
+    }
+    wg.Wait()
+    return results
+}
+
+func (sv *dshCmd) printScrapeResults(
+    results []*scrapeResult, matcher *regexp.Regexp,
+) error {
+    var scraped []*scrapeResult
+    seen := make(map[string]struct{})
+    var names []string
+    for _, result := range results {
+        if result.err != nil {
+            fmt.Fprintf(
+                os.Stderr, "%s: scraping %s: %v\n",
+                result.pod.Spec.NodeName, result.pod.Name, result.err,
+            )
+            continue
+        }
+        scraped = append(scraped, result)
+        for name := range result.series {
+            if _, ok := seen[name]; ok || !matcher.MatchString(name) {
+                continue
+            }
+            seen[name] = struct{}{}
+            names = append(names, name)
+        }
+    }
+    sort.Strings(names)
+
+    if len(names) == 0 {
+        fmt.Fprintf(sv.out, "No matching series found\n")
+    } else {
+        highlight := false
+        if f, ok := sv.out.(*os.File); ok {
+            highlight = term.IsTerminal(int(f.Fd()))
+        }
+
+        w := printers.GetNewTabWriter(sv.out)
+        fmt.Fprintln(w, "SERIES\tNODE\tVALUE\tOUTLIER")
+        for _, name := range names {
+            var present []*scrapeResult
+            var values []float64
+            for _, result := range scraped {
+                if value, ok := result.series[name]; ok {
+                    present = append(present, result)
+                    values = append(values, value)
+                }
+            }
+            flags := outliers(values)
+
+            series := name
+            for i, result := range present {
+                fmt.Fprintf(
+                    w, "%s\t%s\t%s\t%s\n", series, result.pod.Spec.NodeName,
+                    strconv.FormatFloat(values[i], 'g', -1, 64),
+                    outlierString(flags[i], highlight),
+                )
+                series = ""
+            }
+            if len(present) < len(scraped) {
+                fmt.Fprintf(
+                    w, "%s\t<%d other nodes>\t<missing>\t\n", series,
+                    len(scraped)-len(present),
+                )
+            }
+        }
+        if err := w.Flush(); err != nil {
+            return err
+        }
+    }
+
+    if failed := len(results) - len(scraped); failed > 0 {
+        return fmt.Errorf(
+            "scraping failed on %d of %d nodes", failed, len(results),
+        )
+    }
+    return nil
+}
+
+func outlierString(flag int, highlight bool) string {
+    var s string
+    switch flag {
+    case 1:
+        s = "high"
+    case -1:
+        s = "low"
+    default:
+        return ""
+    }
+    if highlight {
+        // bold red, and the last column, so it doesn't throw off the widths
+        return "\x1b[1;31m" + s + "\x1b[0m"
+    }
+    return s
+}
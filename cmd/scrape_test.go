@@ -0,0 +1,142 @@
+package cmd
+
+import (
+    "bytes"
+    "fmt"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "regexp"
+    "strings"
+    "testing"
+
+    v1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// A stand-in for the pods' metrics endpoints, with a path per pod
+var testMetrics = map[string]string{
+    "agent-a": "queue_depth 10\nerrors_total 1\n",
+    "agent-b": "queue_depth 11\nerrors_total 1\n",
+    "agent-c": "queue_depth 12\nerrors_total 1\n",
+    "agent-d": "queue_depth 500\n",
+    "agent-e": "queue_depth 9\nerrors_total 1\n",
+}
+
+func testScraper(t *testing.T) scrapeFunc {
+    server := httptest.NewServer(http.HandlerFunc(
+        func(w http.ResponseWriter, r *http.Request) {
+            metrics, ok := testMetrics[strings.TrimPrefix(r.URL.Path, "/")]
+            if !ok {
+                http.Error(w, "no such pod", http.StatusInternalServerError)
+                return
+            }
+            fmt.Fprint(w, metrics)
+        },
+    ))
+    t.Cleanup(server.Close)
+
+    return func(pod *v1.Pod) ([]byte, error) {
+        resp, err := http.Get(server.URL + "/" + pod.Name)
+        if err != nil {
+            return nil, err
+        }
+        defer resp.Body.Close()
+        if resp.StatusCode != http.StatusOK {
+            return nil, fmt.Errorf("got %s", resp.Status)
+        }
+        return io.ReadAll(resp.Body)
+    }
+}
+
+func testScrapePods(names ...string) []v1.Pod {
+    var pods []v1.Pod
+    for _, name := range names {
+        pods = append(pods, v1.Pod{
+            ObjectMeta: metav1.ObjectMeta{Name: name},
+            Spec:       v1.PodSpec{NodeName: "node-" + name[len(name)-1:]},
+        })
+    }
+    return pods
+}
+
+func TestScrapePods(t *testing.T) {
+    pods := testScrapePods(
+        "agent-e", "agent-broken", "agent-a", "agent-d", "agent-c", "agent-b",
+    )
+    results := scrapePods(pods, testScraper(t), 2)
+
+    var nodes []string
+    for _, result := range results {
+        nodes = append(nodes, result.pod.Spec.NodeName)
+    }
+    want := "node-a node-b node-c node-d node-e node-n"
+    if got := strings.Join(nodes, " "); got != want {
+        t.Errorf("results for %s, want them sorted by node: %s", got, want)
+    }
+
+    for _, result := range results {
+        if result.pod.Name == "agent-broken" {
+            if result.err == nil {
+                t.Errorf("expected an error scraping agent-broken")
+            }
+            continue
+        }
+        if result.err != nil {
+            t.Errorf("scraping %s: %v", result.pod.Name, result.err)
+        }
+    }
+}
+
+func TestPrintScrapeResults(t *testing.T) {
+    pods := testScrapePods(
+        "agent-a", "agent-b", "agent-c", "agent-d", "agent-e", "agent-broken",
+    )
+    results := scrapePods(pods, testScraper(t), 10)
+
+    var out bytes.Buffer
+    sv := &dshCmd{out: &out}
+    err := sv.printScrapeResults(results, regexp.MustCompile(""))
+    if err == nil || !strings.Contains(err.Error(), "1 of 6 nodes") {
+        t.Errorf("expected the failed scrape to be reported, got %v", err)
+    }
+
+    lines := make(map[string]string)
+    series := ""
+    for _, line := range strings.Split(out.String(), "\n")[1:] {
+        fields := strings.Fields(line)
+        if len(fields) == 0 {
+            continue
+        }
+        if !strings.HasPrefix(fields[0], "node-") &&
+            !strings.HasPrefix(fields[0], "<") {
+            series, fields = fields[0], fields[1:]
+        }
+        lines[series+" "+fields[0]] = strings.Join(fields[1:], " ")
+    }
+
+    for key, want := range map[string]string{
+        "queue_depth node-a":  "10",
+        "queue_depth node-d":  "500 high",
+        "queue_depth node-e":  "9",
+        "errors_total node-a": "1",
+        "errors_total <1":     "other nodes> <missing>",
+    } {
+        if got, ok := lines[key]; !ok || got != want {
+            t.Errorf(
+                "%s: got %q, want %q in:\n%s", key, got, want, out.String(),
+            )
+        }
+    }
+    for key := range lines {
+        if strings.HasSuffix(key, "node-n") {
+            t.Errorf(
+                "the failed scrape shouldn't be in the table:\n%s",
+                out.String(),
+            )
+        }
+        if strings.HasPrefix(key, "errors_total node-d") {
+            t.Errorf("node-d has no errors_total:\n%s", out.String())
+        }
+    }
+}
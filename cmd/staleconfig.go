@@ -0,0 +1,297 @@
+package cmd
+
+import (
+    "errors"
+    "fmt"
+    "github.com/spf13/cobra"
+    "io"
+    "sort"
+    "strings"
+    "time"
+
+    v1 "k8s.io/api/core/v1"
+    apierrors "k8s.io/apimachinery/pkg/api/errors"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/cli-runtime/pkg/printers"
+    "k8s.io/client-go/rest"
+)
+
+func newDshStaleConfigCommand(
+    out io.Writer, context *string, namespace *string, nodeName *string,
+) *cobra.Command {
+    var restart bool
+    var pace time.Duration
+    var timeout time.Duration
+
+    dshStaleConfig := &dshCmd{
+        out: out,
+    }
+
+    cmd := &cobra.Command{
+        Use:   "stale-config <daemonset> [<options>]",
+        Short: "find pods for <daemonset> running with old config",
+        Long:
+`Finds pods of the daemonset that started before the last change to one of
+the ConfigMaps or Secrets they use, whether through env, envFrom, or a
+(projected) volume. Daemons often only read their config at startup, so
+these pods are probably still running with the old config.
+
+With --restart, the stale pods are restarted one at a time: each pod is
+deleted, and we wait for its replacement to be ready, and then --pace, before
+moving on to the next one.`,
+        Annotations: map[string]string{daemonSetArgAnnotation: "true"},
+        Args: cobra.MatchAll(cobra.ExactArgs(1)),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            return dshStaleConfig.staleConfig(
+                *context, *namespace, args[0], *nodeName, restart, pace,
+                timeout,
+            )
+        },
+    }
+
+    cmd.Flags().BoolVar(
+        &restart, "restart", false, "Restart the pods with stale config",
+    )
+    cmd.Flags().DurationVar(
+        &pace, "pace", 10*time.Second,
+        "How long to wait after a restarted pod is ready before the next one",
+    )
+    cmd.Flags().DurationVar(
+        &timeout, "timeout", 5*time.Minute,
+        "How long to wait for each restarted pod to be ready",
+    )
+
+    return cmd
+}
+
+// configRef is a ConfigMap or Secret used by a pod.
+type configRef struct {
+    kind string
+    name string
+}
+
+func (c configRef) String() string {
+    return strings.ToLower(c.kind) + "/" + c.name
+}
+
+// stalePod is a pod along with the config that changed since it started.
+type stalePod struct {
+    pod     *v1.Pod
+    started time.Time
+    stale   []string
+}
+
+func (sv *dshCmd) staleConfig(
+    kcontext string, namespace string, ds string, nodeName string,
+    restart bool, pace time.Duration, timeout time.Duration,
+) error {
+    clientset, config, err := getClientSet(kcontext)
+    if err != nil {
+        return err
+    }
+
+    pods, err := getPodsForDaemonSet(clientset, ds, namespace, nodeName)
+    if err != nil {
+        return err
+    }
+
+    if len(pods) == 0 {
+        fmt.Printf("No pods found\n")
+        return nil
+    }
+
+    modified := make(map[configRef]time.Time)
+    var stale []stalePod
+    for i := range pods {
+        pod := &pods[i]
+        started := podConfigLoadTime(pod)
+        if started.IsZero() {
+            continue
+        }
+        var changed []string
+        for _, ref := range podConfigRefs(pod) {
+            if _, ok := modified[ref]; !ok {
+                modified[ref], err = configModifiedTime(
+                    config, namespace, ref,
+                )
+                if err != nil {
+                    return err
+                }
+            }
+            if modified[ref].After(started) {
+                changed = append(changed, fmt.Sprintf(
+                    "%s (changed %s ago)", ref,
+                    translateTimestampSince(metav1.NewTime(modified[ref])),
+                ))
+            }
+        }
+        if len(changed) > 0 {
+            stale = append(stale, stalePod{pod, started, changed})
+        }
+    }
+
+    if len(stale) == 0 {
+        fmt.Fprintf(
+            sv.out, "All %d pods are running with current config\n", len(pods),
+        )
+        return nil
+    }
+
+    sort.Slice(stale, func(i, j int) bool {
+        return stale[i].pod.Spec.NodeName < stale[j].pod.Spec.NodeName
+    })
+    w := printers.GetNewTabWriter(sv.out)
+    fmt.Fprintln(w, "NODE\tPOD\tSTARTED\tSTALE CONFIG")
+    for _, s := range stale {
+        fmt.Fprintf(
+            w, "%s\t%s\t%s ago\t%s\n", s.pod.Spec.NodeName, s.pod.Name,
+            translateTimestampSince(metav1.NewTime(s.started)),
+            strings.Join(s.stale, ", "),
+        )
+    }
+    if err := w.Flush(); err != nil {
+        return err
+    }
+    fmt.Fprintf(
+        sv.out, "\n%d of %d pods are running with stale config\n",
+        len(stale), len(pods),
+    )
+
+    if !restart {
+        return nil
+    }
+    if err := preflight(clientset, namespace, permDeletePods); err != nil {
+        return err
+    }
+
+    for i, s := range stale {
+        if i > 0 && pace > 0 {
+            time.Sleep(pace)
+        }
+        fmt.Fprintf(
+            sv.out, "Restarting pod %s on node %s\n",
+            s.pod.Name, s.pod.Spec.NodeName,
+        )
+        replacement, err := restartDaemonPod(clientset, s.pod, timeout)
+        if err != nil {
+            return fmt.Errorf(
+                "stopping after restarting %d of %d pods: %w", i, len(stale),
+                err,
+            )
+        }
+        fmt.Fprintf(
+            sv.out, "pod \"%s\" ready at %s\n", replacement.Name,
+            podReadyTime(replacement).Format(time.RFC1123),
+        )
+    }
+    return nil
+}
+
+// podConfigLoadTime is when the pod last (re)read its config: the start of
+// its oldest running container, since a restarted container has read the
+// config again.
+func podConfigLoadTime(pod *v1.Pod) time.Time {
+    var oldest time.Time
+    for _, status := range pod.Status.ContainerStatuses {
+        if status.State.Running == nil {
+            continue
+        }
+        started := status.State.Running.StartedAt.Time
+        if oldest.IsZero() || started.Before(oldest) {
+            oldest = started
+        }
+    }
+    if oldest.IsZero() && pod.Status.StartTime != nil {
+        oldest = pod.Status.StartTime.Time
+    }
+    return oldest
+}
+
+// podConfigRefs returns every ConfigMap and Secret pod refers to.
+func podConfigRefs(pod *v1.Pod) []configRef {
+    seen := make(map[configRef]struct{})
+    var refs []configRef
+    add := func(kind string, name string) {
+        ref := configRef{kind, name}
+        if _, ok := seen[ref]; ok || name == "" {
+            return
+        }
+        seen[ref] = struct{}{}
+        refs = append(refs, ref)
+    }
+
+    containers := append(
+        append([]v1.Container{}, pod.Spec.InitContainers...),
+        pod.Spec.Containers...,
+    )
+    for _, container := range containers {
+        for _, from := range container.EnvFrom {
+            if from.ConfigMapRef != nil {
+                add("ConfigMap", from.ConfigMapRef.Name)
+            }
+            if from.SecretRef != nil {
+                add("Secret", from.SecretRef.Name)
+            }
+        }
+        for _, env := range container.Env {
+            if env.ValueFrom == nil {
+                continue
+            }
+            if env.ValueFrom.ConfigMapKeyRef != nil {
+                add("ConfigMap", env.ValueFrom.ConfigMapKeyRef.Name)
+            }
+            if env.ValueFrom.SecretKeyRef != nil {
+                add("Secret", env.ValueFrom.SecretKeyRef.Name)
+            }
+        }
+    }
+
+    for _, volume := range pod.Spec.Volumes {
+        switch {
+        case volume.ConfigMap != nil:
+            add("ConfigMap", volume.ConfigMap.Name)
+        case volume.Secret != nil:
+            add("Secret", volume.Secret.SecretName)
+        case volume.Projected != nil:
+            for _, source := range volume.Projected.Sources {
+                if source.ConfigMap != nil {
+                    add("ConfigMap", source.ConfigMap.Name)
+                }
+                if source.Secret != nil {
+                    add("Secret", source.Secret.Name)
+                }
+            }
+        }
+    }
+    return refs
+}
+
+// configModifiedTime is our best guess at when a ConfigMap or Secret last
+// changed. The API doesn't keep a modification time, but every write
+// updates the time of the field manager that did it. A missing object
+// hasn't changed as far as the pod is concerned. Only the metadata is read,
+// not the data.
+func configModifiedTime(
+    config *rest.Config, namespace string, ref configRef,
+) (time.Time, error) {
+    switch ref.kind {
+    case "ConfigMap", "Secret":
+    default:
+        return time.Time{}, errors.New("unknown config kind " + ref.kind)
+    }
+    object, err := getConfigMetadata(config, namespace, ref.kind, ref.name)
+    if err != nil {
+        if apierrors.IsNotFound(err) {
+            return time.Time{}, nil
+        }
+        return time.Time{}, fmt.Errorf("checking %s: %w", ref, err)
+    }
+
+    modified := object.GetCreationTimestamp().Time
+    for _, entry := range object.GetManagedFields() {
+        if entry.Time != nil && entry.Time.After(modified) {
+            modified = entry.Time.Time
+        }
+    }
+    return modified, nil
+}
@@ -0,0 +1,242 @@
+package cmd
+
+import (
+    "fmt"
+    "strconv"
+    "time"
+
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/util/duration"
+    v1 "k8s.io/api/core/v1"
+)
+
+// The reason the node lifecycle controller sets on pods of a node that has
+// gone away.
+const nodeUnreachablePodReason = "NodeLost"
+
+// podSummary is everything 'kubectl get pods' computes about a pod, as
+// opposed to just reading out of its status.
+type podSummary struct {
+    ready       int
+    total       int
+    status      string
+    restarts    int
+    lastRestart metav1.Time
+    initDone    int
+    initTotal   int
+}
+
+// summarizePod mirrors printPod in kubectl's printers, so that STATUS shows
+// things like Init:0/2, CrashLoopBackOff, ContainerCreating, Terminating or
+// Evicted instead of just the phase, and RESTARTS counts every container.
+func summarizePod(pod *v1.Pod) podSummary {
+    summary := podSummary{
+        total:     len(pod.Spec.Containers),
+        initTotal: len(pod.Spec.InitContainers),
+        status:    string(pod.Status.Phase),
+    }
+    if pod.Status.Reason != "" {
+        summary.status = pod.Status.Reason
+    }
+
+    for _, condition := range pod.Status.Conditions {
+        if condition.Type == v1.PodScheduled &&
+                condition.Reason == v1.PodReasonSchedulingGated {
+            summary.status = v1.PodReasonSchedulingGated
+        }
+    }
+
+    initContainers := make(map[string]*v1.Container)
+    for i := range pod.Spec.InitContainers {
+        container := &pod.Spec.InitContainers[i]
+        initContainers[container.Name] = container
+        if isRestartableInitContainer(container) {
+            summary.total++
+        }
+    }
+
+    // sidecars (restartable init containers) keep counting after the pod
+    // has initialized, the others only while it is initializing
+    sidecarRestarts := 0
+    var lastSidecarRestart metav1.Time
+
+    initializing := false
+    for i, container := range pod.Status.InitContainerStatuses {
+        summary.restarts += int(container.RestartCount)
+        updateLastRestart(&summary.lastRestart, container)
+        sidecar := isRestartableInitContainer(initContainers[container.Name])
+        if sidecar {
+            sidecarRestarts += int(container.RestartCount)
+            updateLastRestart(&lastSidecarRestart, container)
+        }
+
+        terminated := container.State.Terminated
+        waiting := container.State.Waiting
+        switch {
+        case terminated != nil && terminated.ExitCode == 0:
+            summary.initDone++
+            continue
+        case sidecar && container.Started != nil && *container.Started:
+            summary.initDone++
+            if container.Ready {
+                summary.ready++
+            }
+            continue
+        case terminated != nil:
+            if terminated.Reason != "" {
+                summary.status = "Init:" + terminated.Reason
+            } else if terminated.Signal != 0 {
+                summary.status = fmt.Sprintf("Init:Signal:%d", terminated.Signal)
+            } else {
+                summary.status = fmt.Sprintf(
+                    "Init:ExitCode:%d", terminated.ExitCode,
+                )
+            }
+        case waiting != nil && waiting.Reason != "" &&
+                waiting.Reason != "PodInitializing":
+            summary.status = "Init:" + waiting.Reason
+        default:
+            summary.status = fmt.Sprintf(
+                "Init:%d/%d", i, len(pod.Spec.InitContainers),
+            )
+        }
+        initializing = true
+        break
+    }
+
+    if !initializing || isPodInitialized(pod) {
+        summary.restarts = sidecarRestarts
+        summary.lastRestart = lastSidecarRestart
+        hasRunning := false
+        for i := len(pod.Status.ContainerStatuses) - 1; i >= 0; i-- {
+            container := pod.Status.ContainerStatuses[i]
+            summary.restarts += int(container.RestartCount)
+            updateLastRestart(&summary.lastRestart, container)
+
+            terminated := container.State.Terminated
+            waiting := container.State.Waiting
+            switch {
+            case waiting != nil && waiting.Reason != "":
+                summary.status = waiting.Reason
+            case terminated != nil && terminated.Reason != "":
+                summary.status = terminated.Reason
+            case terminated != nil && terminated.Signal != 0:
+                summary.status = fmt.Sprintf("Signal:%d", terminated.Signal)
+            case terminated != nil:
+                summary.status = fmt.Sprintf("ExitCode:%d", terminated.ExitCode)
+            case container.Ready && container.State.Running != nil:
+                hasRunning = true
+                summary.ready++
+            }
+        }
+
+        // a container that's still running trumps one that has completed
+        if summary.status == "Completed" && hasRunning {
+            if isPodReady(pod) {
+                summary.status = "Running"
+            } else {
+                summary.status = "NotReady"
+            }
+        }
+    }
+
+    if pod.DeletionTimestamp != nil &&
+            pod.Status.Reason == nodeUnreachablePodReason {
+        summary.status = "Unknown"
+    } else if pod.DeletionTimestamp != nil &&
+            pod.Status.Phase != v1.PodSucceeded &&
+            pod.Status.Phase != v1.PodFailed {
+        summary.status = "Terminating"
+    }
+
+    return summary
+}
+
+// restartsString renders restarts the way kubectl does, e.g. "3 (5m ago)".
+func (s podSummary) restartsString() string {
+    restarts := strconv.Itoa(s.restarts)
+    if s.restarts != 0 && !s.lastRestart.IsZero() {
+        restarts = fmt.Sprintf(
+            "%s (%s ago)", restarts, translateTimestampSince(s.lastRestart),
+        )
+    }
+    return restarts
+}
+
+// initString is what we show in the INIT column: completed init containers
+// out of all of them.
+func (s podSummary) initString() string {
+    if s.initTotal == 0 {
+        return "<none>"
+    }
+    return fmt.Sprintf("%d/%d", s.initDone, s.initTotal)
+}
+
+func updateLastRestart(last *metav1.Time, container v1.ContainerStatus) {
+    terminated := container.LastTerminationState.Terminated
+    if terminated != nil && last.Before(&terminated.FinishedAt) {
+        *last = terminated.FinishedAt
+    }
+}
+
+func isRestartableInitContainer(container *v1.Container) bool {
+    if container == nil || container.RestartPolicy == nil {
+        return false
+    }
+    return *container.RestartPolicy == v1.ContainerRestartPolicyAlways
+}
+
+func isPodInitialized(pod *v1.Pod) bool {
+    for _, condition := range pod.Status.Conditions {
+        if condition.Type == v1.PodInitialized {
+            return condition.Status == v1.ConditionTrue
+        }
+    }
+    return false
+}
+
+func isPodReady(pod *v1.Pod) bool {
+    for _, condition := range pod.Status.Conditions {
+        if condition.Type == v1.PodReady {
+            return condition.Status == v1.ConditionTrue
+        }
+    }
+    return false
+}
+
+// readinessGatesString is the READINESS GATES column: how many of the pod's
+// readiness gates are satisfied.
+func readinessGatesString(pod *v1.Pod) string {
+    if len(pod.Spec.ReadinessGates) == 0 {
+        return "<none>"
+    }
+    trueConditions := 0
+    for _, gate := range pod.Spec.ReadinessGates {
+        for _, condition := range pod.Status.Conditions {
+            if condition.Type == gate.ConditionType {
+                if condition.Status == v1.ConditionTrue {
+                    trueConditions++
+                }
+                break
+            }
+        }
+    }
+    return fmt.Sprintf("%d/%d", trueConditions, len(pod.Spec.ReadinessGates))
+}
+
+// translateTimestampSince returns the elapsed time since timestamp in
+// human-readable approximation, like the AGE column of kubectl.
+func translateTimestampSince(timestamp metav1.Time) string {
+    if timestamp.IsZero() {
+        return "<unknown>"
+    }
+    return duration.HumanDuration(time.Since(timestamp.Time))
+}
+
+// orNone returns s, or "<none>" if s is empty.
+func orNone(s string) string {
+    if s == "" {
+        return "<none>"
+    }
+    return s
+}
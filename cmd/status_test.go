@@ -0,0 +1,351 @@
+package cmd
+
+import (
+    "testing"
+    "time"
+
+    v1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func running(name string, ready bool, restarts int32) v1.ContainerStatus {
+    return v1.ContainerStatus{
+        Name: name, Ready: ready, RestartCount: restarts,
+        State: v1.ContainerState{Running: &v1.ContainerStateRunning{}},
+    }
+}
+
+func waiting(name string, reason string, restarts int32) v1.ContainerStatus {
+    return v1.ContainerStatus{
+        Name: name, RestartCount: restarts,
+        State: v1.ContainerState{
+            Waiting: &v1.ContainerStateWaiting{Reason: reason},
+        },
+    }
+}
+
+func terminated(
+    name string, reason string, exitCode int32, signal int32,
+) v1.ContainerStatus {
+    return v1.ContainerStatus{
+        Name: name,
+        State: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{
+            Reason: reason, ExitCode: exitCode, Signal: signal,
+        }},
+    }
+}
+
+func condition(
+    conditionType v1.PodConditionType, status v1.ConditionStatus,
+) v1.PodCondition {
+    return v1.PodCondition{Type: conditionType, Status: status}
+}
+
+// summaryPod is a pod with the named containers and init containers, the
+// ones starting with "sidecar" being sidecars, and status.
+func summaryPod(
+    containers []string, initContainers []string, status v1.PodStatus,
+) *v1.Pod {
+    always := v1.ContainerRestartPolicyAlways
+    pod := &v1.Pod{Status: status}
+    for _, name := range containers {
+        pod.Spec.Containers = append(pod.Spec.Containers, v1.Container{
+            Name: name,
+        })
+    }
+    for _, name := range initContainers {
+        container := v1.Container{Name: name}
+        if len(name) >= 7 && name[:7] == "sidecar" {
+            container.RestartPolicy = &always
+        }
+        pod.Spec.InitContainers = append(pod.Spec.InitContainers, container)
+    }
+    return pod
+}
+
+func TestSummarizePod(t *testing.T) {
+    now := metav1.NewTime(time.Now())
+
+    tests := []struct {
+        name     string
+        pod      *v1.Pod
+        ready    int
+        total    int
+        status   string
+        restarts int
+        initDone int
+    }{
+        {
+            name: "running",
+            pod: summaryPod([]string{"agent"}, nil, v1.PodStatus{
+                Phase:             v1.PodRunning,
+                ContainerStatuses: []v1.ContainerStatus{
+                    running("agent", true, 0),
+                },
+            }),
+            ready: 1, total: 1, status: "Running",
+        },
+        {
+            name: "crash looping",
+            pod: summaryPod([]string{"agent", "exporter"}, nil, v1.PodStatus{
+                Phase: v1.PodRunning,
+                ContainerStatuses: []v1.ContainerStatus{
+                    waiting("agent", "CrashLoopBackOff", 5),
+                    running("exporter", true, 1),
+                },
+            }),
+            ready: 1, total: 2, status: "CrashLoopBackOff", restarts: 6,
+        },
+        {
+            name: "scheduling gated",
+            pod: summaryPod([]string{"agent"}, nil, v1.PodStatus{
+                Phase: v1.PodPending,
+                Conditions: []v1.PodCondition{{
+                    Type:   v1.PodScheduled,
+                    Status: v1.ConditionFalse,
+                    Reason: v1.PodReasonSchedulingGated,
+                }},
+            }),
+            total: 1, status: v1.PodReasonSchedulingGated,
+        },
+        {
+            name: "first init container running",
+            pod: summaryPod(
+                []string{"agent"}, []string{"setup", "migrate"},
+                v1.PodStatus{
+                    Phase: v1.PodPending,
+                    InitContainerStatuses: []v1.ContainerStatus{
+                        running("setup", false, 0),
+                        waiting("migrate", "PodInitializing", 0),
+                    },
+                },
+            ),
+            total: 1, status: "Init:0/2",
+        },
+        {
+            name: "second init container pending",
+            pod: summaryPod(
+                []string{"agent"}, []string{"setup", "migrate"},
+                v1.PodStatus{
+                    Phase: v1.PodPending,
+                    InitContainerStatuses: []v1.ContainerStatus{
+                        terminated("setup", "Completed", 0, 0),
+                        waiting("migrate", "PodInitializing", 0),
+                    },
+                },
+            ),
+            total: 1, status: "Init:1/2", initDone: 1,
+        },
+        {
+            name: "init container crash looping",
+            pod: summaryPod(
+                []string{"agent"}, []string{"setup"},
+                v1.PodStatus{
+                    Phase: v1.PodPending,
+                    InitContainerStatuses: []v1.ContainerStatus{
+                        waiting("setup", "CrashLoopBackOff", 3),
+                    },
+                },
+            ),
+            total: 1, status: "Init:CrashLoopBackOff", restarts: 3,
+        },
+        {
+            name: "init container failed",
+            pod: summaryPod(
+                []string{"agent"}, []string{"setup"},
+                v1.PodStatus{
+                    Phase: v1.PodPending,
+                    InitContainerStatuses: []v1.ContainerStatus{
+                        terminated("setup", "Error", 1, 0),
+                    },
+                },
+            ),
+            total: 1, status: "Init:Error",
+        },
+        {
+            name: "init container exited without a reason",
+            pod: summaryPod(
+                []string{"agent"}, []string{"setup"},
+                v1.PodStatus{
+                    Phase: v1.PodPending,
+                    InitContainerStatuses: []v1.ContainerStatus{
+                        terminated("setup", "", 2, 0),
+                    },
+                },
+            ),
+            total: 1, status: "Init:ExitCode:2",
+        },
+        {
+            name: "init container killed",
+            pod: summaryPod(
+                []string{"agent"}, []string{"setup"},
+                v1.PodStatus{
+                    Phase: v1.PodPending,
+                    InitContainerStatuses: []v1.ContainerStatus{
+                        terminated("setup", "", 137, 9),
+                    },
+                },
+            ),
+            total: 1, status: "Init:Signal:9",
+        },
+        {
+            name: "init restarts stop counting once initialized",
+            pod: summaryPod(
+                []string{"agent"}, []string{"setup"},
+                v1.PodStatus{
+                    Phase: v1.PodRunning,
+                    Conditions: []v1.PodCondition{
+                        condition(v1.PodInitialized, v1.ConditionTrue),
+                    },
+                    InitContainerStatuses: []v1.ContainerStatus{
+                        func() v1.ContainerStatus {
+                            s := terminated("setup", "Completed", 0, 0)
+                            s.RestartCount = 2
+                            return s
+                        }(),
+                    },
+                    ContainerStatuses: []v1.ContainerStatus{
+                        running("agent", true, 1),
+                    },
+                },
+            ),
+            ready: 1, total: 1, status: "Running", restarts: 1, initDone: 1,
+        },
+        {
+            name: "sidecar counts as a container",
+            pod: summaryPod(
+                []string{"agent"}, []string{"setup", "sidecar-proxy"},
+                v1.PodStatus{
+                    Phase: v1.PodRunning,
+                    Conditions: []v1.PodCondition{
+                        condition(v1.PodInitialized, v1.ConditionTrue),
+                    },
+                    InitContainerStatuses: []v1.ContainerStatus{
+                        terminated("setup", "Completed", 0, 0),
+                        func() v1.ContainerStatus {
+                            s := running("sidecar-proxy", true, 3)
+                            started := true
+                            s.Started = &started
+                            return s
+                        }(),
+                    },
+                    ContainerStatuses: []v1.ContainerStatus{
+                        running("agent", true, 1),
+                    },
+                },
+            ),
+            ready: 2, total: 2, status: "Running", restarts: 4, initDone: 2,
+        },
+        {
+            name: "sidecar not started yet",
+            pod: summaryPod(
+                []string{"agent"}, []string{"sidecar-proxy"},
+                v1.PodStatus{
+                    Phase: v1.PodPending,
+                    InitContainerStatuses: []v1.ContainerStatus{
+                        waiting("sidecar-proxy", "PodInitializing", 0),
+                    },
+                },
+            ),
+            total: 2, status: "Init:0/1",
+        },
+        {
+            name: "completed container with one still running",
+            pod: summaryPod([]string{"job", "agent"}, nil, v1.PodStatus{
+                Phase: v1.PodRunning,
+                Conditions: []v1.PodCondition{
+                    condition(v1.PodReady, v1.ConditionFalse),
+                },
+                ContainerStatuses: []v1.ContainerStatus{
+                    terminated("job", "Completed", 0, 0),
+                    running("agent", true, 0),
+                },
+            }),
+            ready: 1, total: 2, status: "NotReady",
+        },
+        {
+            name: "evicted",
+            pod: summaryPod([]string{"agent"}, nil, v1.PodStatus{
+                Phase: v1.PodFailed, Reason: "Evicted",
+            }),
+            total: 1, status: "Evicted",
+        },
+        {
+            name: "terminating",
+            pod: func() *v1.Pod {
+                pod := summaryPod([]string{"agent"}, nil, v1.PodStatus{
+                    Phase: v1.PodRunning,
+                    ContainerStatuses: []v1.ContainerStatus{
+                        running("agent", true, 0),
+                    },
+                })
+                pod.DeletionTimestamp = &now
+                return pod
+            }(),
+            ready: 1, total: 1, status: "Terminating",
+        },
+        {
+            name: "deleted after succeeding",
+            pod: func() *v1.Pod {
+                pod := summaryPod([]string{"agent"}, nil, v1.PodStatus{
+                    Phase: v1.PodSucceeded,
+                    ContainerStatuses: []v1.ContainerStatus{
+                        terminated("agent", "Completed", 0, 0),
+                    },
+                })
+                pod.DeletionTimestamp = &now
+                return pod
+            }(),
+            total: 1, status: "Completed",
+        },
+        {
+            name: "node lost",
+            pod: func() *v1.Pod {
+                pod := summaryPod([]string{"agent"}, nil, v1.PodStatus{
+                    Phase: v1.PodRunning, Reason: nodeUnreachablePodReason,
+                })
+                pod.DeletionTimestamp = &now
+                return pod
+            }(),
+            total: 1, status: "Unknown",
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            s := summarizePod(tt.pod)
+            if s.ready != tt.ready || s.total != tt.total ||
+                s.status != tt.status || s.restarts != tt.restarts ||
+                s.initDone != tt.initDone {
+                t.Errorf(
+                    "got %d/%d %s, %d restarts, %d init done, want " +
+                    "%d/%d %s, %d restarts, %d init done",
+                    s.ready, s.total, s.status, s.restarts, s.initDone,
+                    tt.ready, tt.total, tt.status, tt.restarts, tt.initDone,
+                )
+            }
+        })
+    }
+}
+
+func TestRestartsString(t *testing.T) {
+    tests := []struct {
+        summary podSummary
+        want    string
+    }{
+        {podSummary{}, "0"},
+        {podSummary{restarts: 3}, "3"},
+        {
+            podSummary{
+                restarts:    3,
+                lastRestart: metav1.NewTime(time.Now().Add(-5 * time.Minute)),
+            },
+            "3 (5m ago)",
+        },
+    }
+    for _, tt := range tests {
+        if got := tt.summary.restartsString(); got != tt.want {
+            t.Errorf("got %q, want %q", got, tt.want)
+        }
+    }
+}
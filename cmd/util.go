@@ -7,6 +7,8 @@ import (
     "k8s.io/client-go/rest"
     corev1 "k8s.io/api/core/v1"
     metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/fields"
+    "k8s.io/client-go/metadata"
 )
 
 func getClientSet(context string) (*kubernetes.Clientset, *rest.Config, error) {
@@ -71,13 +73,9 @@ func getDaemonSetInfo(
         if nodeName != "" && pod.Spec.NodeName != nodeName {
             continue
         }
-        for _, owner := range pod.OwnerReferences {
-            if owner.Kind == "DaemonSet" && (
-                    daemonSetName == "" || owner.Name == daemonSetName) {
-                pods = append(pods, pod)
-                ds_set[owner.Name] = struct{}{}
-                break
-            }
+        if owner := daemonSetOwner(&pod, daemonSetName); owner != "" {
+            pods = append(pods, pod)
+            ds_set[owner] = struct{}{}
         }
     }
 
@@ -89,15 +87,86 @@ func getDaemonSetInfo(
     return pods, daemonSets, nil
 }
 
-func countReadyContainers(
-    containerStatuses []corev1.ContainerStatus,
-) (int, int) {
-    var readyCount, totalCount int
-    for _, status := range containerStatuses {
-        totalCount++
-        if status.Ready {
-            readyCount++
+// daemonSetOwner returns the name of the daemonset owning pod, or "" if the pod
+// isn't owned by a daemonset (or not by daemonSetName, if that is set).
+func daemonSetOwner(pod *corev1.Pod, daemonSetName string) string {
+    for _, owner := range pod.OwnerReferences {
+        if owner.Kind == "DaemonSet" && (
+                daemonSetName == "" || owner.Name == daemonSetName) {
+            return owner.Name
         }
     }
-    return readyCount, totalCount
+    return ""
+}
+
+// daemonSetListOptions builds ListOptions that let the API server do as much
+// of the filtering as it can: pods on nodeName, matching the selector of
+// daemonSetName. Callers still need to check ownership with daemonSetOwner.
+func daemonSetListOptions(
+    clientset *kubernetes.Clientset, daemonSetName, namespace string,
+    nodeName string,
+) (metav1.ListOptions, error) {
+    var listOptions metav1.ListOptions
+    if nodeName != "" {
+        listOptions.FieldSelector = fields.OneTermEqualSelector(
+            "spec.nodeName", nodeName,
+        ).String()
+    }
+    if daemonSetName != "" {
+        ds, err := clientset.AppsV1().DaemonSets(namespace).Get(
+            context.TODO(), daemonSetName, metav1.GetOptions{},
+        )
+        if err != nil {
+            return listOptions, err
+        }
+        selector, err := metav1.LabelSelectorAsSelector(ds.Spec.Selector)
+        if err != nil {
+            return listOptions, err
+        }
+        listOptions.LabelSelector = selector.String()
+    }
+    return listOptions, nil
+}
+
+// getContextInfo returns the name of the context we're using, and of the
+// user it logs in as, according to the kubeconfig.
+func getContextInfo(context string) (string, string, error) {
+    loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+    configOverrides := &clientcmd.ConfigOverrides{
+        CurrentContext: context,
+    }
+    kubeConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+        loadingRules, configOverrides,
+    )
+
+    rawConfig, err := kubeConfig.RawConfig()
+    if err != nil {
+        return "", "", err
+    }
+    if context == "" {
+        context = rawConfig.CurrentContext
+    }
+    if kubeContext, ok := rawConfig.Contexts[context]; ok {
+        return context, kubeContext.AuthInfo, nil
+    }
+    return context, "", nil
+}
+
+// getConfigMetadata gets only the metadata of the ConfigMap or Secret name,
+// so a Secret's data isn't read, or needed to be readable, for its
+// resourceVersion or managedFields.
+func getConfigMetadata(
+    config *rest.Config, namespace string, kind string, name string,
+) (*metav1.PartialObjectMetadata, error) {
+    client, err := metadata.NewForConfig(config)
+    if err != nil {
+        return nil, err
+    }
+    resource := corev1.SchemeGroupVersion.WithResource("configmaps")
+    if kind == "Secret" {
+        resource = corev1.SchemeGroupVersion.WithResource("secrets")
+    }
+    return client.Resource(resource).Namespace(namespace).Get(
+        context.TODO(), name, metav1.GetOptions{},
+    )
 }
@@ -0,0 +1,204 @@
+package cmd
+
+import (
+    "context"
+    "github.com/liggitt/tabwriter"
+
+    apierrors "k8s.io/apimachinery/pkg/api/errors"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/runtime"
+    "k8s.io/apimachinery/pkg/types"
+    "k8s.io/apimachinery/pkg/watch"
+    "k8s.io/cli-runtime/pkg/printers"
+    "k8s.io/client-go/kubernetes"
+    "k8s.io/kubectl/pkg/cmd/get"
+    v1 "k8s.io/api/core/v1"
+)
+
+// watchPods prints a row for every daemonset pod that gets added, deleted,
+// or changes in a way that shows up in the table, in the style of
+// 'kubectl get -w --output-watch-events'. When the watch expires or the
+// server closes it, we relist and print whatever we missed in the meantime.
+func (sv *dshCmd) watchPods(
+    clientset *kubernetes.Clientset, namespace string, ds string,
+    nodeName string, printer printers.ResourcePrinter,
+    printFlags *get.PrintFlags, watchOnly bool,
+) error {
+    listOptions, err := daemonSetListOptions(
+        clientset, ds, namespace, nodeName,
+    )
+    if err != nil {
+        return err
+    }
+
+    // like kubectl, share one tabwriter so the columns of successive rows
+    // line up as well as they can
+    out := printers.GetNewTabWriter(sv.out)
+
+    // what we last printed for each pod, so we only print real changes
+    known := make(map[types.UID]*v1.Pod)
+    quiet := watchOnly
+
+    for {
+        podList, err := clientset.CoreV1().Pods(namespace).List(
+            context.TODO(), listOptions,
+        )
+        if err != nil {
+            return err
+        }
+
+        seen := make(map[types.UID]struct{})
+        for i := range podList.Items {
+            pod := &podList.Items[i]
+            if daemonSetOwner(pod, ds) == "" {
+                continue
+            }
+            seen[pod.UID] = struct{}{}
+            err := printWatchEvent(
+                out, printer, printFlags, known, watch.Added, pod, quiet,
+            )
+            if err != nil {
+                return err
+            }
+        }
+        for uid, pod := range known {
+            if _, ok := seen[uid]; ok {
+                continue
+            }
+            err := printWatchEvent(
+                out, printer, printFlags, known, watch.Deleted, pod, false,
+            )
+            if err != nil {
+                return err
+            }
+        }
+        quiet = false
+
+        watchOptions := listOptions
+        watchOptions.ResourceVersion = podList.ResourceVersion
+        watchOptions.AllowWatchBookmarks = true
+        watcher, err := clientset.CoreV1().Pods(namespace).Watch(
+            context.TODO(), watchOptions,
+        )
+        if err != nil {
+            if apierrors.IsResourceExpired(err) || apierrors.IsGone(err) {
+                continue
+            }
+            return err
+        }
+
+        err = consumeWatch(out, watcher, printer, printFlags, known, ds)
+        watcher.Stop()
+        if err != nil {
+            return err
+        }
+    }
+}
+
+// consumeWatch prints events until the watch is closed or expires, either of
+// which returns nil so the caller relists.
+func consumeWatch(
+    out *tabwriter.Writer, watcher watch.Interface,
+    printer printers.ResourcePrinter,
+    printFlags *get.PrintFlags, known map[types.UID]*v1.Pod, ds string,
+) error {
+    for event := range watcher.ResultChan() {
+        switch event.Type {
+        case watch.Bookmark:
+            continue
+        case watch.Error:
+            err := apierrors.FromObject(event.Object)
+            if apierrors.IsResourceExpired(err) || apierrors.IsGone(err) {
+                return nil
+            }
+            return err
+        }
+
+        pod, ok := event.Object.(*v1.Pod)
+        if !ok || daemonSetOwner(pod, ds) == "" {
+            continue
+        }
+        err := printWatchEvent(
+            out, printer, printFlags, known, event.Type, pod, false,
+        )
+        if err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// printWatchEvent prints pod unless nothing visible has changed since we last
+// printed it. If quiet is set, we only record the pod's state.
+func printWatchEvent(
+    out *tabwriter.Writer, printer printers.ResourcePrinter,
+    printFlags *get.PrintFlags,
+    known map[types.UID]*v1.Pod, eventType watch.EventType, pod *v1.Pod,
+    quiet bool,
+) error {
+    last, existed := known[pod.UID]
+
+    if eventType == watch.Deleted {
+        delete(known, pod.UID)
+    } else {
+        if existed && podWatchSummary(last) == podWatchSummary(pod) {
+            return nil
+        }
+        known[pod.UID] = pod
+        if existed {
+            eventType = watch.Modified
+        } else {
+            eventType = watch.Added
+        }
+    }
+
+    if quiet {
+        return nil
+    }
+
+    if isHumanOutput(printFlags) {
+        err := printer.PrintObj(watchEventTable(eventType, pod), out)
+        if err != nil {
+            return err
+        }
+        return out.Flush()
+    }
+
+    pod.SetGroupVersionKind(v1.SchemeGroupVersion.WithKind("Pod"))
+    var err error
+    switch *printFlags.OutputFormat {
+    case "json", "yaml":
+        err = printer.PrintObj(&metav1.WatchEvent{
+            Type:   string(eventType),
+            Object: runtime.RawExtension{Object: pod},
+        }, out)
+    default:
+        err = printer.PrintObj(pod, out)
+    }
+    if err != nil {
+        return err
+    }
+    return out.Flush()
+}
+
+// podWatchSummary is the part of a pod's table row that we consider worth
+// printing again when it changes.
+func podWatchSummary(pod *v1.Pod) podSummary {
+    summary := summarizePod(pod)
+    // only the restart count matters, not how long ago the last one was
+    summary.lastRestart = metav1.Time{}
+    return summary
+}
+
+// watchEventTable is the normal pod table for a single pod, with an EVENT
+// column in front.
+func watchEventTable(eventType watch.EventType, pod *v1.Pod) *metav1.Table {
+    table := podsToTable([]v1.Pod{*pod})
+    table.ColumnDefinitions = append(
+        []metav1.TableColumnDefinition{{Name: "EVENT", Type: "string"}},
+        table.ColumnDefinitions...,
+    )
+    row := &table.Rows[0]
+    row.Cells = append([]interface{}{string(eventType)}, row.Cells...)
+    return table
+}
@@ -11,12 +11,12 @@ var version = "undefined"
 func main() {
     cmd.SetVersion(version)
 
-    dshCmd := cmd.NewDshCommand(
+    err := cmd.Execute(
         genericclioptions.IOStreams{
             In: os.Stdin, Out: os.Stdout, ErrOut: os.Stderr,
-        },
+        }, os.Args[1:],
     )
-    if err := dshCmd.Execute(); err != nil {
+    if err != nil {
         os.Exit(1)
     }
 }